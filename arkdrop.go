@@ -0,0 +1,195 @@
+// Package arkdrop runs ArkDrop, on its own or inside another Go program. Each
+// App owns its database, files, hub and cleaner, so isolated instances can
+// share a process:
+//
+//	cfg := arkdrop.DefaultConfig()
+//	cfg.DataDir = "/var/lib/arkdrop"
+//	app, err := arkdrop.New(*cfg)
+//	if err != nil {
+//		return err
+//	}
+//	defer app.Close()
+//	http.Handle("/", app.Handler())
+package arkdrop
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/cluster"
+	"github.com/zjyl1994/arkdrop/config"
+	"github.com/zjyl1994/arkdrop/metrics"
+	"github.com/zjyl1994/arkdrop/migration"
+	"github.com/zjyl1994/arkdrop/server"
+	"github.com/zjyl1994/arkdrop/service"
+	"gorm.io/gorm"
+)
+
+// Config holds the options documented in docs/configuration.md.
+type Config = config.Config
+
+// DefaultConfig returns a configuration with every option at its default.
+func DefaultConfig() *Config {
+	return config.Default()
+}
+
+// App is one ArkDrop instance.
+type App struct {
+	cfg     *Config
+	store   *service.Store
+	server  *server.Server
+	cluster cluster.Backend
+
+	cancel    context.CancelFunc
+	cleaner   sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// New opens the database of cfg, migrating it unless auto_migrate is off, and
+// starts the background work of the instance: expiry cleanup and the hub
+// relay. Call Close to stop it.
+func New(cfg Config) (app *App, err error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(cfg.DataDir, "files"), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := OpenDatabase(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	store := &service.Store{
+		DB:             db,
+		DataDir:        cfg.DataDir,
+		BodyLimit:      int(cfg.BodyLimit),
+		EventRetention: cfg.EventRetention,
+		Metrics:        metrics.New(),
+	}
+	defer func() {
+		if err != nil {
+			_ = store.Close()
+		}
+	}()
+	err = service.SettingService{Store: store}.Load(service.RuntimeSettings{
+		AutoExpire:           cfg.AutoExpire,
+		AttachmentLinkExpire: cfg.AttachmentLinkExpire,
+		UploadLimit:          cfg.UploadLimit,
+		CleanupInterval:      cfg.CleanupInterval,
+	})
+	if err != nil {
+		return nil, err
+	}
+	removePartialUploads(cfg.DataDir, cfg.ShutdownTimeout)
+
+	backend, err := newCluster(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	srv, err := server.New(&cfg, store, backend)
+	if err != nil {
+		_ = backend.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app = &App{
+		cfg:     &cfg,
+		store:   store,
+		server:  srv,
+		cluster: backend,
+		cancel:  cancel,
+	}
+	srv.Start(ctx)
+	app.cleaner.Add(1)
+	go func() {
+		defer app.cleaner.Done()
+		app.runCleaner(ctx)
+	}()
+	return app, nil
+}
+
+// Fiber returns the fiber app serving the instance, for mounting into
+// another fiber app.
+func (a *App) Fiber() *fiber.App {
+	return a.server.App()
+}
+
+// Handler serves the instance to net/http. Responses are buffered, so the
+// websocket and event stream hub endpoints only work through Fiber or Run.
+func (a *App) Handler() http.Handler {
+	return adaptor.FiberApp(a.server.App())
+}
+
+// Run serves the instance on the configured listen addresses until ctx is
+// cancelled. It does not Close the App.
+func (a *App) Run(ctx context.Context) error {
+	return a.server.Run(ctx)
+}
+
+// Close disconnects hub clients, waits for a running cleanup to stop between
+// two parcels and releases the database and cluster backend.
+func (a *App) Close() error {
+	var err error
+	a.closeOnce.Do(func() {
+		a.cancel()
+		a.cleaner.Wait()
+		a.server.Close()
+		if closeErr := a.cluster.Close(); closeErr != nil {
+			logrus.Errorln("Close cluster backend failed:", closeErr)
+		}
+		err = a.store.Close()
+	})
+	return err
+}
+
+// OpenDatabase opens the database of cfg and brings its schema up to date, or
+// fails when migrations are pending and auto_migrate is off.
+func OpenDatabase(cfg *Config) (*gorm.DB, error) {
+	db, err := service.OpenDB(cfg.DataDir, cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	current, err := migration.Check(db)
+	if err == nil && current != migration.Latest() {
+		if !cfg.AutoMigrate {
+			err = fmt.Errorf("database schema version %d is behind %d, run arkdrop migrate up", current, migration.Latest())
+		} else {
+			err = migration.Migrate(db, filepath.Join(cfg.DataDir, "backups"), migration.Latest(), cfg.MigrateWithoutBackup)
+		}
+	}
+	if err != nil {
+		if sqlDB, dbErr := db.DB(); dbErr == nil {
+			_ = sqlDB.Close()
+		}
+		return nil, err
+	}
+	return db, nil
+}
+
+// newCluster connects to the backend that shares hub messages with the other instances.
+func newCluster(cfg *Config) (cluster.Backend, error) {
+	var backend cluster.Backend
+	var err error
+	switch cfg.HubBackend {
+	case config.HubBackendRedis:
+		backend, err = cluster.NewRedis(cfg.RedisURL)
+	case config.HubBackendPostgres:
+		backend, err = cluster.NewPostgres(cfg.DatabaseURL)
+	default:
+		return cluster.Memory{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect %s hub backend: %w", cfg.HubBackend, err)
+	}
+	logrus.Infoln("Sharing hub messages over", cfg.HubBackend)
+	return backend, nil
+}
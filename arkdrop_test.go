@@ -0,0 +1,109 @@
+package arkdrop
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestApp(t *testing.T, password string) *App {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.Password = password
+	cfg.MDNS = false
+	app, err := New(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := app.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return app
+}
+
+// adminToken signs a session the way login does for a configured password.
+func adminToken(t *testing.T, password string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func do(t *testing.T, app *App, req *http.Request, token string) *http.Response {
+	t.Helper()
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := app.Fiber().Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func listParcels(t *testing.T, app *App, token string) []string {
+	t.Helper()
+	resp := do(t, app, httptest.NewRequest(http.MethodGet, "/api/list", nil), token)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list: status %d", resp.StatusCode)
+	}
+	var body struct {
+		List []struct {
+			Content string `json:"content"`
+		} `json:"list"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	contents := make([]string, 0, len(body.List))
+	for _, parcel := range body.List {
+		contents = append(contents, parcel.Content)
+	}
+	return contents
+}
+
+func TestTwoApps(t *testing.T) {
+	first := newTestApp(t, "first-password")
+	second := newTestApp(t, "second-password")
+	firstToken := adminToken(t, "first-password")
+	secondToken := adminToken(t, "second-password")
+
+	for _, app := range []*App{first, second} {
+		if resp := do(t, app, httptest.NewRequest(http.MethodGet, "/api/health", nil), ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("health: status %d", resp.StatusCode)
+		}
+	}
+
+	form := url.Values{"content": {"only in the first"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/create", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if resp := do(t, first, req, firstToken); resp.StatusCode != http.StatusOK {
+		t.Fatalf("create: status %d", resp.StatusCode)
+	}
+
+	if got := listParcels(t, first, firstToken); len(got) != 1 || got[0] != "only in the first" {
+		t.Errorf("first instance parcels = %q", got)
+	}
+	if got := listParcels(t, second, secondToken); len(got) != 0 {
+		t.Errorf("second instance parcels = %q, want none", got)
+	}
+
+	// Each instance signs sessions with its own key.
+	if resp := do(t, second, httptest.NewRequest(http.MethodGet, "/api/list", nil), firstToken); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("second instance accepted a session of the first: status %d", resp.StatusCode)
+	}
+}
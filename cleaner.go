@@ -0,0 +1,105 @@
+package arkdrop
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/server"
+	"github.com/zjyl1994/arkdrop/service"
+)
+
+// runCleaner removes expired data until ctx is cancelled. A cleanup that is
+// running then stops between parcels, so no parcel is left half deleted.
+func (a *App) runCleaner(ctx context.Context) {
+	parcelService := service.ParcelService{Store: a.store}
+	pairingService := service.PairingService{Store: a.store}
+	hubEventService := service.HubEventService{Store: a.store}
+	authSessionService := service.AuthSessionService{Store: a.store}
+
+	doClean := func() {
+		// With several instances only the leader cleans up. The lock outlives
+		// one interval so the leader keeps it from one run to the next.
+		leader, err := a.cluster.Lead(ctx, "cleanup", 2*a.store.CurrentSettings().CleanupInterval)
+		if err != nil {
+			if ctx.Err() == nil {
+				logrus.Errorln("Take cleanup leader lock failed:", err)
+			}
+			return
+		}
+		if !leader {
+			logrus.Debugln("Another instance leads cleanup, skipping.")
+			return
+		}
+		err = parcelService.CleanExpired(ctx)
+		if err != nil && ctx.Err() == nil {
+			logrus.Errorln("Clean expired parcels failed:", err)
+		}
+		err = parcelService.CleanExpiredAttachmentShares()
+		if err != nil {
+			logrus.Errorln("Clean expired attachment shares failed:", err)
+		}
+		err = pairingService.CleanExpired()
+		if err != nil {
+			logrus.Errorln("Clean expired pairing codes failed:", err)
+		}
+		err = hubEventService.CleanExpired()
+		if err != nil {
+			logrus.Errorln("Clean expired hub events failed:", err)
+		}
+		err = authSessionService.CleanExpired()
+		if err != nil {
+			logrus.Errorln("Clean expired auth sessions failed:", err)
+		}
+	}
+
+	doClean()
+
+	settingsChanged := a.store.WatchSettings()
+	interval := a.store.CurrentSettings().CleanupInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			doClean()
+		case settings := <-settingsChanged:
+			// A shorter expiry may already cover more parcels, so clean right away.
+			doClean()
+			if settings.CleanupInterval != interval {
+				interval = settings.CleanupInterval
+				ticker.Reset(interval)
+			}
+		}
+	}
+}
+
+// removePartialUploads deletes files left behind by uploads that were cut off
+// before they were fully written. Another instance sharing data_dir may still
+// be writing a file, so only those untouched for longer than maxAge go.
+func removePartialUploads(dataDir string, maxAge time.Duration) {
+	matches, err := filepath.Glob(filepath.Join(dataDir, "files", "*"+server.PartialUploadSuffix))
+	if err != nil {
+		logrus.Warnln("List partial uploads failed:", err)
+		return
+	}
+	removed := 0
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			logrus.Warnln("Remove partial upload failed:", path, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		logrus.Infoln("Removed", removed, "partial uploads.")
+	}
+}
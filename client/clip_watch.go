@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/hub"
+)
+
+const clipReconnectDelay = 3 * time.Second
+
+type ClipWatchOptions struct {
+	// Server is the base URL of the ArkDrop instance including any base_path,
+	// e.g. http://192.168.1.2:8080 or https://tools.example.com/drop.
+	Server   string
+	Token    string
+	Channel  string
+	Interval time.Duration
+}
+
+// clipMirror remembers the last text seen on either side so a copied entry is not sent back.
+type clipMirror struct {
+	mu   sync.Mutex
+	last string
+}
+
+func (m *clipMirror) swap(text string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if text == m.last {
+		return false
+	}
+	m.last = text
+	return true
+}
+
+// hubURL turns the server base URL into the websocket URL of the hub.
+func hubURL(opts ClipWatchOptions) (string, error) {
+	u, err := url.Parse(strings.TrimRight(opts.Server, "/") + "/api/ws")
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http", "":
+		u.Scheme = "ws"
+	}
+	query := u.Query()
+	query.Set("token", opts.Token)
+	if opts.Channel != "" {
+		query.Set("channel", opts.Channel)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// WatchClipboard mirrors the local text clipboard with a hub channel until ctx is done,
+// reconnecting whenever the connection drops.
+func WatchClipboard(ctx context.Context, opts ClipWatchOptions) error {
+	tool, err := detectClipboardTool()
+	if err != nil {
+		return err
+	}
+	endpoint, err := hubURL(opts)
+	if err != nil {
+		return err
+	}
+	mirror := &clipMirror{}
+	if current, err := tool.Read(); err == nil {
+		mirror.swap(current)
+	}
+
+	for {
+		err := watchOnce(ctx, endpoint, tool, mirror, opts.Interval)
+		if ctx.Err() != nil {
+			return nil
+		}
+		logrus.Warnln("Clipboard hub connection lost:", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(clipReconnectDelay):
+		}
+	}
+}
+
+func watchOnce(ctx context.Context, endpoint string, tool clipboardTool, mirror *clipMirror, interval time.Duration) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	logrus.Infoln("Clipboard watch connected.")
+
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			clip, ok, err := hub.ParseClipboardMessage(message)
+			if !ok || err != nil || clip.Kind != hub.ClipboardText {
+				continue
+			}
+			if mirror.swap(clip.Data) {
+				if err := tool.Write(clip.Data); err != nil {
+					logrus.Warnln("Write local clipboard failed:", err)
+				}
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return nil
+		case err := <-readErr:
+			return err
+		case <-ticker.C:
+			text, err := tool.Read()
+			if err != nil {
+				logrus.Warnln("Read local clipboard failed:", err)
+				continue
+			}
+			if text == "" || !mirror.swap(text) {
+				continue
+			}
+			message, err := json.Marshal(hub.ClipboardMessage{
+				Type: hub.ClipboardMessageType,
+				Kind: hub.ClipboardText,
+				MIME: "text/plain",
+				Data: text,
+			})
+			if err != nil {
+				return err
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return err
+			}
+		}
+	}
+}
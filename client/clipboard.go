@@ -0,0 +1,74 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var ErrNoClipboardTool = errors.New("no clipboard tool found, install wl-clipboard, xclip or xsel")
+
+// clipboardTool is a pair of commands reading and writing the text clipboard.
+type clipboardTool struct {
+	read  []string
+	write []string
+}
+
+// detectClipboardTool picks the standard clipboard commands of the platform.
+func detectClipboardTool() (clipboardTool, error) {
+	var candidates []clipboardTool
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = []clipboardTool{{read: []string{"pbpaste"}, write: []string{"pbcopy"}}}
+	case "windows":
+		candidates = []clipboardTool{{
+			read:  []string{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+			write: []string{"powershell.exe", "-NoProfile", "-Command", "$input | Set-Clipboard"},
+		}}
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			candidates = append(candidates, clipboardTool{read: []string{"wl-paste", "--no-newline"}, write: []string{"wl-copy"}})
+		}
+		candidates = append(candidates,
+			clipboardTool{read: []string{"xclip", "-selection", "clipboard", "-o"}, write: []string{"xclip", "-selection", "clipboard", "-i"}},
+			clipboardTool{read: []string{"xsel", "--clipboard", "--output"}, write: []string{"xsel", "--clipboard", "--input"}},
+		)
+	}
+	for _, tool := range candidates {
+		if _, err := exec.LookPath(tool.read[0]); err != nil {
+			continue
+		}
+		if _, err := exec.LookPath(tool.write[0]); err != nil {
+			continue
+		}
+		return tool, nil
+	}
+	return clipboardTool{}, ErrNoClipboardTool
+}
+
+func (t clipboardTool) Read() (string, error) {
+	var stdout bytes.Buffer
+	cmd := exec.Command(t.read[0], t.read[1:]...)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		// An empty clipboard makes some tools exit non-zero.
+		if stdout.Len() == 0 {
+			return "", nil
+		}
+		return "", err
+	}
+	text := stdout.String()
+	if runtime.GOOS == "windows" {
+		text = strings.TrimSuffix(text, "\r\n")
+	}
+	return text, nil
+}
+
+func (t clipboardTool) Write(text string) error {
+	cmd := exec.Command(t.write[0], t.write[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
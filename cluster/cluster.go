@@ -0,0 +1,45 @@
+// Package cluster lets several ArkDrop instances behind a load balancer act as
+// one: it carries hub messages between them and elects the instance that runs
+// periodic jobs.
+package cluster
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// Topic is the Redis channel or PostgreSQL notification channel hub messages travel on.
+	Topic = "arkdrop_hub"
+
+	reconnectDelay = time.Second
+)
+
+// Backend connects the instances sharing a deployment.
+type Backend interface {
+	// Publish sends data to every instance. Subscribers may get their own
+	// instance's messages back, so data should say where it comes from.
+	Publish(ctx context.Context, data []byte) error
+	// Subscribe has handler called for each message until Close. Messages
+	// published while the connection is being restored are lost.
+	Subscribe(handler func(data []byte))
+	// Lead reports whether this instance holds the named leader lock, taking
+	// it when it is free. The lock is kept for at least ttl; call Lead again
+	// before then to keep it.
+	Lead(ctx context.Context, name string, ttl time.Duration) (bool, error)
+	Close() error
+}
+
+// Memory is the backend of a single instance: there is nobody to tell, and
+// this instance always leads.
+type Memory struct{}
+
+func (Memory) Publish(ctx context.Context, data []byte) error { return nil }
+
+func (Memory) Subscribe(handler func(data []byte)) {}
+
+func (Memory) Lead(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (Memory) Close() error { return nil }
@@ -0,0 +1,144 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// MaxPostgresPayload is the largest notification PostgreSQL accepts.
+const MaxPostgresPayload = 7999
+
+// Postgres carries hub messages with LISTEN/NOTIFY and holds leader locks as
+// session advisory locks, which the server drops with the session when an
+// instance dies.
+type Postgres struct {
+	dsn  string
+	pool *pgxpool.Pool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+
+	// locks keeps the connection of each advisory lock held.
+	locks map[string]*pgxpool.Conn
+}
+
+// NewPostgres connects to the database at dsn, usually the one holding the data.
+func NewPostgres(dsn string) (*Postgres, error) {
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(context.Background()); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Postgres{
+		dsn:    dsn,
+		pool:   pool,
+		ctx:    ctx,
+		cancel: cancel,
+		locks:  make(map[string]*pgxpool.Conn),
+	}, nil
+}
+
+func (p *Postgres) Publish(ctx context.Context, data []byte) error {
+	if len(data) > MaxPostgresPayload {
+		return errors.New("message too large for a PostgreSQL notification")
+	}
+	_, err := p.pool.Exec(ctx, "SELECT pg_notify($1, $2)", Topic, string(data))
+	return err
+}
+
+// Subscribe listens on a connection of its own, reconnecting when it drops.
+func (p *Postgres) Subscribe(handler func(data []byte)) {
+	p.done.Add(1)
+	go func() {
+		defer p.done.Done()
+		for p.ctx.Err() == nil {
+			err := p.listen(handler)
+			if p.ctx.Err() != nil {
+				return
+			}
+			logrus.Warnln("PostgreSQL hub listener failed, reconnecting:", err)
+			select {
+			case <-p.ctx.Done():
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}()
+}
+
+func (p *Postgres) listen(handler func(data []byte)) error {
+	conn, err := pgx.Connect(p.ctx, p.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(p.ctx, "LISTEN "+Topic); err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.WaitForNotification(p.ctx)
+		if err != nil {
+			return err
+		}
+		handler([]byte(notification.Payload))
+	}
+}
+
+// Lead is not safe for concurrent use with the same name.
+func (p *Postgres) Lead(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	if conn, ok := p.locks[name]; ok {
+		// The lock lives as long as the session does.
+		if err := conn.Ping(ctx); err == nil {
+			return true, nil
+		}
+		logrus.Warnln("Lost leader lock", name)
+		conn.Release()
+		delete(p.locks, name)
+	}
+
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	var acquired bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", lockKey(name)).Scan(&acquired); err != nil {
+		conn.Release()
+		return false, err
+	}
+	if !acquired {
+		conn.Release()
+		return false, nil
+	}
+	p.locks[name] = conn
+	return true, nil
+}
+
+func (p *Postgres) Close() error {
+	p.cancel()
+	p.done.Wait()
+	for name, conn := range p.locks {
+		// Closing the session releases its advisory locks.
+		_ = conn.Hijack().Close(context.Background())
+		delete(p.locks, name)
+	}
+	p.pool.Close()
+	return nil
+}
+
+// lockKey maps a lock name to the 64-bit key advisory locks take.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("arkdrop:" + name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,105 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/utils"
+)
+
+// renewLock extends a lock only while this instance still owns it.
+var renewLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseLock deletes a lock only while this instance still owns it.
+var releaseLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Redis carries hub messages over Redis pub/sub and keeps leader locks as
+// keys that expire unless their owner renews them.
+type Redis struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+	// owner identifies this instance as the holder of a lock.
+	owner string
+	held  map[string]bool
+}
+
+// NewRedis connects to the server at url, e.g. redis://:password@host:6379/0.
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return &Redis{
+		client: client,
+		owner:  utils.SecureRandString(16),
+		held:   make(map[string]bool),
+	}, nil
+}
+
+func (r *Redis) Publish(ctx context.Context, data []byte) error {
+	return r.client.Publish(ctx, Topic, data).Err()
+}
+
+// Subscribe relies on go-redis to resubscribe after a lost connection.
+func (r *Redis) Subscribe(handler func(data []byte)) {
+	r.pubsub = r.client.Subscribe(context.Background(), Topic)
+	go func() {
+		for msg := range r.pubsub.Channel() {
+			handler([]byte(msg.Payload))
+		}
+	}()
+}
+
+// Lead is not safe for concurrent use with the same name.
+func (r *Redis) Lead(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	key := "arkdrop:lock:" + name
+	if r.held[name] {
+		renewed, err := renewLock.Run(ctx, r.client, []string{key}, r.owner, ttl.Milliseconds()).Int()
+		if err != nil {
+			return false, err
+		}
+		if renewed == 1 {
+			return true, nil
+		}
+		logrus.Warnln("Lost leader lock", name)
+		r.held[name] = false
+	}
+	acquired, err := r.client.SetNX(ctx, key, r.owner, ttl).Result()
+	if err != nil {
+		return false, err
+	}
+	r.held[name] = acquired
+	return acquired, nil
+}
+
+// Close hands held locks over right away rather than letting them expire.
+func (r *Redis) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for name, held := range r.held {
+		if held {
+			if err := releaseLock.Run(ctx, r.client, []string{"arkdrop:lock:" + name}, r.owner).Err(); err != nil {
+				logrus.Warnln("Release leader lock failed:", name, err)
+			}
+		}
+	}
+	if r.pubsub != nil {
+		_ = r.pubsub.Close()
+	}
+	return r.client.Close()
+}
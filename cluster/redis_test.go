@@ -0,0 +1,110 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zjyl1994/arkdrop/utils"
+)
+
+// TestRedis runs two instances against the server named by REDIS_URL.
+func TestRedis(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL is not set")
+	}
+	connect := func() *Redis {
+		r, err := NewRedis(redisURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = r.Close() })
+		return r
+	}
+	a, b := connect(), connect()
+	ctx := context.Background()
+
+	t.Run("publish", func(t *testing.T) {
+		received := make(chan string, 4)
+		a.Subscribe(func(data []byte) { received <- "a:" + string(data) })
+		b.Subscribe(func(data []byte) { received <- "b:" + string(data) })
+		// Subscriptions are confirmed asynchronously.
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			subs, err := a.client.PubSubNumSub(ctx, Topic).Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subs[Topic] >= 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%d subscribers, want 2", subs[Topic])
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if err := a.Publish(ctx, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for range 2 {
+			select {
+			case msg := <-received:
+				got[msg] = true
+			case <-time.After(5 * time.Second):
+				t.Fatalf("received %v, want the message on both instances", got)
+			}
+		}
+		if !got["a:hello"] || !got["b:hello"] {
+			t.Errorf("received %v, want the message on both instances", got)
+		}
+	})
+
+	t.Run("leader lock", func(t *testing.T) {
+		name := "test-" + utils.SecureRandString(8)
+		lead := func(r *Redis) bool {
+			t.Helper()
+			leads, err := r.Lead(ctx, name, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return leads
+		}
+		if !lead(a) || lead(b) {
+			t.Fatal("the first instance didn't get the free lock alone")
+		}
+		if !lead(a) || lead(b) {
+			t.Fatal("the leader lost the lock on renewal")
+		}
+
+		// A leader whose lock expired and was taken over steps down.
+		if err := a.client.Del(ctx, "arkdrop:lock:"+name).Err(); err != nil {
+			t.Fatal(err)
+		}
+		if !lead(b) || lead(a) {
+			t.Fatal("the lock wasn't taken over after it expired")
+		}
+		if ttl := b.client.PTTL(ctx, "arkdrop:lock:"+name).Val(); ttl <= 0 || ttl > time.Minute {
+			t.Errorf("lock expires in %s, want within a minute", ttl)
+		}
+
+		// Closing hands the lock over at once.
+		leaving, err := NewRedis(redisURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name = "test-" + utils.SecureRandString(8)
+		if !lead(leaving) || lead(a) {
+			t.Fatal("the first instance didn't get the free lock alone")
+		}
+		if err := leaving.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !lead(a) {
+			t.Error("the lock of a closed instance wasn't released")
+		}
+	})
+}
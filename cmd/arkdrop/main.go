@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/startup"
+)
+
+func main() {
+	var err error
+	// Arguments starting with a dash are server flags, anything else names a command.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		err = startup.RunCommand(os.Args[1:])
+	} else {
+		err = startup.Start(os.Args[1:])
+	}
+	if err != nil {
+		logrus.Fatalln(err.Error())
+	}
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/zjyl1994/arkdrop/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "ARKDROP_"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// option describes one Config field as found through its struct tags.
+type option struct {
+	Key     string
+	Env     string
+	Flag    string
+	Default string
+	Desc    string
+	Secret  bool
+	unit    string
+	field   int
+}
+
+var options = func() []option {
+	t := reflect.TypeOf(Config{})
+	opts := make([]option, 0, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		key := field.Tag.Get("key")
+		opts = append(opts, option{
+			Key:     key,
+			Env:     envPrefix + strings.ToUpper(key),
+			Flag:    strings.ReplaceAll(key, "_", "-"),
+			Default: field.Tag.Get("default"),
+			Desc:    field.Tag.Get("desc"),
+			Secret:  field.Tag.Get("secret") == "true",
+			unit:    field.Tag.Get("unit"),
+			field:   i,
+		})
+	}
+	return opts
+}()
+
+func lookupOption(key string) (option, bool) {
+	for _, opt := range options {
+		if opt.Key == key {
+			return opt, true
+		}
+	}
+	return option{}, false
+}
+
+func (o option) value(c *Config) reflect.Value {
+	return reflect.ValueOf(c).Elem().Field(o.field)
+}
+
+// Type names the kind of value the option takes, as shown in the schema.
+func (o option) Type() string {
+	v := reflect.ValueOf(Config{}).Field(o.field)
+	switch {
+	case v.Type() == durationType:
+		return "duration"
+	case o.unit == "bytes":
+		return "size"
+	case v.Kind() == reflect.Bool:
+		return "bool"
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		return "integer"
+	case v.Kind() == reflect.Slice:
+		return "list"
+	default:
+		return "string"
+	}
+}
+
+// set parses raw the way the option's type expects. Lists are comma separated.
+func (o option) set(c *Config, raw string) error {
+	v := o.value(c)
+	switch o.Type() {
+	case "duration":
+		d, err := utils.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case "size":
+		n, err := utils.ParseSize(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case "bool":
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case "integer":
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case "list":
+		v.Set(reflect.ValueOf(utils.SplitList(raw)))
+	default:
+		v.SetString(raw)
+	}
+	return nil
+}
+
+// format renders the current value in the syntax set accepts.
+func (o option) format(c *Config) any {
+	v := o.value(c)
+	switch o.Type() {
+	case "duration":
+		return utils.FormatDuration(time.Duration(v.Int()))
+	case "size":
+		return utils.FormatSize(v.Int())
+	case "list":
+		list := v.Interface().([]string)
+		if list == nil {
+			list = []string{}
+		}
+		return list
+	default:
+		return v.Interface()
+	}
+}
+
+// Default returns the configuration with every option at its default.
+func Default() *Config {
+	cfg := new(Config)
+	for _, opt := range options {
+		if opt.Default == "" {
+			continue
+		}
+		if err := opt.set(cfg, opt.Default); err != nil {
+			panic(fmt.Sprintf("default of %s: %v", opt.Key, err))
+		}
+	}
+	return cfg
+}
+
+// Load builds the configuration from defaults, the config file, ARKDROP_*
+// environment variables and command-line flags, each overriding the ones
+// before. The config file is named by -config or ARKDROP_CONFIG and is read
+// as TOML when it ends in .toml, as YAML otherwise.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("arkdrop", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("ARKDROP_CONFIG"), "config file, YAML or TOML")
+	var flags []flagValue
+	for _, opt := range options {
+		fs.Var(&flagValue{opt: opt, parsed: &flags}, opt.Flag, opt.Desc)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := loadFile(cfg, *path); err != nil {
+			return nil, err
+		}
+	}
+	// Empty variables count as unset, so compose files can list them blank.
+	for _, opt := range options {
+		if raw := os.Getenv(opt.Env); raw != "" {
+			if err := opt.set(cfg, raw); err != nil {
+				return nil, fmt.Errorf("%s: %w", opt.Env, err)
+			}
+		}
+	}
+	for _, f := range flags {
+		if err := f.opt.set(cfg, f.raw); err != nil {
+			return nil, fmt.Errorf("-%s: %w", f.opt.Flag, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]any)
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(data, &values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		opt, ok := lookupOption(key)
+		if !ok {
+			return fmt.Errorf("config file %s: %w", path, unknownKeyError(key))
+		}
+		if err := setFileValue(cfg, opt, values[key]); err != nil {
+			return fmt.Errorf("config file %s: %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// unknownKeyError points at the right spelling when a key was written in the
+// environment or flag style.
+func unknownKeyError(key string) error {
+	normalized := strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	normalized = strings.TrimPrefix(normalized, strings.ToLower(envPrefix))
+	if _, ok := lookupOption(normalized); ok {
+		return fmt.Errorf("unknown key %q, did you mean %q", key, normalized)
+	}
+	return fmt.Errorf("unknown key %q", key)
+}
+
+func setFileValue(cfg *Config, opt option, value any) error {
+	switch value := value.(type) {
+	case nil:
+		return opt.set(cfg, "")
+	case []any:
+		if opt.Type() != "list" {
+			return fmt.Errorf("expect a single value, got a list")
+		}
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			items = append(items, fmt.Sprint(item))
+		}
+		opt.value(cfg).Set(reflect.ValueOf(items))
+		return nil
+	case map[string]any:
+		return fmt.Errorf("expect a value, got a table")
+	default:
+		return opt.set(cfg, fmt.Sprint(value))
+	}
+}
+
+// flagValue records a flag so it can be applied after the file and environment.
+type flagValue struct {
+	opt    option
+	raw    string
+	parsed *[]flagValue
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.opt.Default
+}
+
+func (f *flagValue) Set(raw string) error {
+	if err := f.opt.set(new(Config), raw); err != nil {
+		return err
+	}
+	*f.parsed = append(*f.parsed, flagValue{opt: f.opt, raw: raw})
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.opt.Type() == "bool"
+}
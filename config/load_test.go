@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BodyLimit != 10<<20 {
+		t.Errorf("body_limit = %d, want 10MB", cfg.BodyLimit)
+	}
+	if cfg.UploadLimit != cfg.BodyLimit {
+		t.Errorf("upload_limit = %d, want body_limit %d", cfg.UploadLimit, cfg.BodyLimit)
+	}
+	if cfg.HubBackend != HubBackendMemory || cfg.TLSMode != TLSModeOff {
+		t.Errorf("hub_backend = %q, tls_mode = %q", cfg.HubBackend, cfg.TLSMode)
+	}
+	if len(cfg.Listen) != 1 || cfg.Listen[0] != ":8080" {
+		t.Errorf("listen = %v, want [:8080]", cfg.Listen)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "arkdrop.yaml", strings.Join([]string{
+		"auto_expire: 2d",
+		"cleanup_interval: 2h",
+		"shutdown_timeout: 20s",
+		"listen: [':9000', 'unix:/tmp/arkdrop.sock']",
+	}, "\n"))
+	t.Setenv("ARKDROP_CONFIG", path)
+	t.Setenv("ARKDROP_CLEANUP_INTERVAL", "3h")
+	t.Setenv("ARKDROP_SHUTDOWN_TIMEOUT", "40s")
+	// Blank variables count as unset.
+	t.Setenv("ARKDROP_AUTO_EXPIRE", "")
+
+	cfg, err := Load([]string{"-shutdown-timeout", "50s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AutoExpire != 48*time.Hour {
+		t.Errorf("auto_expire = %v, want the file's 48h", cfg.AutoExpire)
+	}
+	if cfg.CleanupInterval != 3*time.Hour {
+		t.Errorf("cleanup_interval = %v, want the environment's 3h", cfg.CleanupInterval)
+	}
+	if cfg.ShutdownTimeout != 50*time.Second {
+		t.Errorf("shutdown_timeout = %v, want the flag's 50s", cfg.ShutdownTimeout)
+	}
+	if len(cfg.Listen) != 2 || cfg.Listen[1] != "unix:/tmp/arkdrop.sock" {
+		t.Errorf("listen = %v", cfg.Listen)
+	}
+	if cfg.AttachmentLinkExpire != time.Hour {
+		t.Errorf("attachment_link_expire = %v, want the default 1h", cfg.AttachmentLinkExpire)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "arkdrop.toml", "debug = true\nrate_limit_per_ip = 7\ntrusted_proxies = ['10.0.0.0/8']\n")
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Debug || cfg.RateLimitPerIP != 7 || len(cfg.TrustedProxies) != 1 {
+		t.Errorf("debug = %v, rate_limit_per_ip = %d, trusted_proxies = %v", cfg.Debug, cfg.RateLimitPerIP, cfg.TrustedProxies)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file string
+		args []string
+		want string
+	}{
+		{name: "unknown key", file: "body-limit: 1MB", want: `did you mean "body_limit"`},
+		{name: "list for a single value", file: "password: [a, b]", want: "expect a single value"},
+		{name: "bad flag value", args: []string{"-auto-expire", "soon"}, want: "auto-expire"},
+		{name: "extra argument", args: []string{"serve"}, want: `unexpected argument "serve"`},
+		{name: "zero body limit", args: []string{"-body-limit", "0"}, want: "body_limit must be greater than 0"},
+		{name: "upload above body", args: []string{"-upload-limit", "20MB"}, want: "upload_limit must be between"},
+		{name: "bad hub backend", args: []string{"-hub-backend", "etcd"}, want: `invalid hub_backend "etcd"`},
+		{name: "redis without url", args: []string{"-hub-backend", "redis"}, want: "redis_url is required"},
+		{
+			name: "redis without database",
+			args: []string{"-hub-backend", "redis", "-redis-url", "redis://localhost"},
+			want: "database_url is required by the redis hub backend",
+		},
+		{name: "postgres without database", args: []string{"-hub-backend", "postgres"}, want: "database_url is required by the postgres hub backend"},
+		{name: "bad socket mode", args: []string{"-socket-mode", "999"}, want: "invalid socket_mode"},
+		{name: "public url path", args: []string{"-public-url", "https://example.com/drop", "-base-path", "/other"}, want: "public_url path must match base_path"},
+		{name: "redirect without tls", args: []string{"-http-redirect", ":80"}, want: "http_redirect requires TLS"},
+		{name: "oidc without allow list", args: []string{"-oidc-issuer", "https://id.example.com", "-oidc-client-id", "arkdrop", "-public-url", "https://example.com"}, want: "oidc_allowed_emails or oidc_allowed_groups"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"-config", writeFile(t, "arkdrop.yaml", tc.file)}, args...)
+			}
+			_, err := Load(args)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateDerived(t *testing.T) {
+	cfg := Default()
+	cfg.PublicURL = "https://example.com/drop/"
+	cfg.TLSCert, cfg.TLSKey = "cert.pem", "key.pem"
+	cfg.WebAuthnRPID = "example.com"
+	cfg.OIDCIssuer, cfg.OIDCClientID = "https://id.example.com", "arkdrop"
+	cfg.OIDCAllowedGroups = []string{"admins"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PublicURL != "https://example.com/drop" || cfg.BasePath != "/drop" {
+		t.Errorf("public_url = %q, base_path = %q", cfg.PublicURL, cfg.BasePath)
+	}
+	if cfg.TLSMode != TLSModeFile {
+		t.Errorf("tls_mode = %q, want file", cfg.TLSMode)
+	}
+	if cfg.OIDCRedirectURL != "https://example.com/drop/api/oidc/callback" {
+		t.Errorf("oidc_redirect_url = %q", cfg.OIDCRedirectURL)
+	}
+	if len(cfg.WebAuthnOrigins) != 1 || cfg.WebAuthnOrigins[0] != "https://example.com" {
+		t.Errorf("webauthn_origins = %v", cfg.WebAuthnOrigins)
+	}
+}
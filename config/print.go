@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "********"
+
+// Print writes the effective configuration as YAML, usable as a config file
+// once the redacted secrets are filled back in.
+func (c *Config) Print(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, opt := range options {
+		value := opt.format(c)
+		if opt.Secret && value != "" {
+			value = redacted
+		}
+		var node yaml.Node
+		if err := node.Encode(value); err != nil {
+			return err
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: opt.Key}, &node)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// WriteSchema documents every option as a Markdown table.
+func WriteSchema(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("| Key | Environment | Flag | Type | Default | Description |\n")
+	sb.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+	for _, opt := range options {
+		def := opt.Default
+		if def != "" {
+			def = "`" + def + "`"
+		}
+		fmt.Fprintf(&sb, "| `%s` | `%s` | `-%s` | %s | %s | %s |\n",
+			opt.Key, opt.Env, opt.Flag, opt.Type(), def, strings.ReplaceAll(opt.Desc, "|", "\\|"))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
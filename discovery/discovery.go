@@ -0,0 +1,156 @@
+package discovery
+
+import (
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/mdns"
+	"github.com/zjyl1994/arkdrop/utils"
+)
+
+// ServiceType is the DNS-SD service ArkDrop instances announce themselves under.
+const ServiceType = "_arkdrop._tcp"
+
+// Info describes the instance announced on the LAN.
+type Info struct {
+	Instance string
+	Port     int
+	Version  string
+	TLS      bool
+	BasePath string
+}
+
+func (i Info) txt() []string {
+	txt := []string{"version=" + i.Version}
+	if i.TLS {
+		txt = append(txt, "tls=1")
+	}
+	if i.BasePath != "" {
+		txt = append(txt, "path="+i.BasePath)
+	}
+	return txt
+}
+
+// Advertiser answers mDNS queries for one instance until Shutdown is called.
+type Advertiser struct {
+	server *mdns.Server
+}
+
+func Advertise(info Info) (*Advertiser, error) {
+	ips, err := utils.LANAddrs()
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	hostname = strings.SplitN(hostname, ".", 2)[0]
+	instance := utils.COALESCE(info.Instance, "ArkDrop on "+hostname)
+
+	service, err := mdns.NewMDNSService(instance, ServiceType, "", hostname+".local.", info.Port, ips, info.txt())
+	if err != nil {
+		return nil, err
+	}
+	server, err := mdns.NewServer(&mdns.Config{Zone: service})
+	if err != nil {
+		return nil, err
+	}
+	return &Advertiser{server: server}, nil
+}
+
+func (a *Advertiser) Shutdown() error {
+	return a.server.Shutdown()
+}
+
+// Instance is an ArkDrop server found on the LAN.
+type Instance struct {
+	Name     string `json:"name"`
+	Host     string `json:"host"`
+	Addr     net.IP `json:"addr"`
+	Port     int    `json:"port"`
+	Version  string `json:"version"`
+	TLS      bool   `json:"tls"`
+	BasePath string `json:"base_path,omitempty"`
+}
+
+func (i Instance) URL() string {
+	scheme := "http"
+	if i.TLS {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(i.Addr.String(), strconv.Itoa(i.Port)) + i.BasePath
+}
+
+// Browse queries the LAN for ArkDrop instances, collecting answers for timeout.
+func Browse(timeout time.Duration) ([]Instance, error) {
+	entries := make(chan *mdns.ServiceEntry, 16)
+	found := make(map[string]Instance)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for entry := range entries {
+			instance := Instance{
+				Name: unescapeLabel(strings.TrimSuffix(entry.Name, "."+ServiceType+".local.")),
+				Host: entry.Host,
+				Addr: entry.AddrV4,
+				Port: entry.Port,
+			}
+			if instance.Addr == nil {
+				instance.Addr = entry.AddrV6
+			}
+			for _, field := range entry.InfoFields {
+				key, value, _ := strings.Cut(field, "=")
+				switch key {
+				case "version":
+					instance.Version = value
+				case "tls":
+					instance.TLS = value == "1"
+				case "path":
+					instance.BasePath = value
+				}
+			}
+			found[entry.Name] = instance
+		}
+	}()
+
+	err := mdns.Query(&mdns.QueryParam{
+		Service: ServiceType,
+		Domain:  "local",
+		Timeout: timeout,
+		Entries: entries,
+	})
+	close(entries)
+	<-done
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]Instance, 0, len(found))
+	for _, instance := range found {
+		instances = append(instances, instance)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Name < instances[j].Name
+	})
+	return instances, nil
+}
+
+// unescapeLabel drops the backslash escapes DNS applies to spaces and dots in instance names.
+func unescapeLabel(label string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range label {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
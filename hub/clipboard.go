@@ -0,0 +1,76 @@
+package hub
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const ClipboardMessageType = "clipboard"
+
+const (
+	ClipboardText  = "text"
+	ClipboardHTML  = "html"
+	ClipboardImage = "image"
+)
+
+var ErrInvalidClipboard = errors.New("invalid clipboard message")
+
+// ClipboardMessage is the typed hub message carrying a clipboard entry. Data
+// holds the text for text and html entries and base64 encoded bytes for images.
+type ClipboardMessage struct {
+	Type         string `json:"type"`
+	Kind         string `json:"kind"`
+	MIME         string `json:"mime"`
+	Data         string `json:"data"`
+	SourceDevice string `json:"source_device,omitempty"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// ParseClipboardMessage decodes message when it is a clipboard message. The
+// second result is false for any other hub traffic.
+func ParseClipboardMessage(message []byte) (ClipboardMessage, bool, error) {
+	trimmed := strings.TrimSpace(string(message))
+	if !strings.HasPrefix(trimmed, "{") {
+		return ClipboardMessage{}, false, nil
+	}
+	var clip ClipboardMessage
+	if err := json.Unmarshal([]byte(trimmed), &clip); err != nil || clip.Type != ClipboardMessageType {
+		return ClipboardMessage{}, false, nil
+	}
+	if err := clip.normalize(); err != nil {
+		return ClipboardMessage{}, true, err
+	}
+	return clip, true, nil
+}
+
+func (m *ClipboardMessage) normalize() error {
+	switch m.Kind {
+	case ClipboardText:
+		m.MIME = withDefault(m.MIME, "text/plain")
+	case ClipboardHTML:
+		m.MIME = withDefault(m.MIME, "text/html")
+	case ClipboardImage:
+		m.MIME = withDefault(m.MIME, "image/png")
+		if !strings.HasPrefix(m.MIME, "image/") {
+			return ErrInvalidClipboard
+		}
+		if _, err := base64.StdEncoding.DecodeString(m.Data); err != nil {
+			return ErrInvalidClipboard
+		}
+	default:
+		return ErrInvalidClipboard
+	}
+	if m.Data == "" {
+		return ErrInvalidClipboard
+	}
+	return nil
+}
+
+func withDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,16 @@
+// Package hub holds the messages exchanged over the ArkDrop hub, shared by the
+// server and the client without pulling in either's dependencies.
+package hub
+
+// Envelope wraps each message sent to a resuming websocket client with its
+// sequence number. Text payloads travel in Data, binary ones in Payload.
+type Envelope struct {
+	Seq     int64  `json:"seq"`
+	Channel string `json:"channel"`
+	Binary  bool   `json:"binary,omitempty"`
+	Data    string `json:"data,omitempty"`
+	Payload []byte `json:"payload,omitempty"`
+	// Truncated marks the notice that the replay stopped at Seq with more
+	// events left. Resume again from Seq to get them.
+	Truncated bool `json:"truncated,omitempty"`
+}
@@ -1,12 +0,0 @@
-package main
-
-import (
-	"github.com/sirupsen/logrus"
-	"github.com/zjyl1994/arkdrop/startup"
-)
-
-func main() {
-	if err := startup.Start(); err != nil {
-		logrus.Fatalln(err.Error())
-	}
-}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Metrics holds the collectors of one instance, so instances sharing a
+// process keep separate counts.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	HTTPRequests       *prometheus.CounterVec
+	HTTPDuration       *prometheus.HistogramVec
+	UploadBytes        prometheus.Counter
+	DownloadBytes      *prometheus.CounterVec
+	ShareLinksCreated  prometheus.Counter
+	ShareLinkHits      *prometheus.CounterVec
+	CleanupDuration    prometheus.Histogram
+	CleanupDeleted     prometheus.Counter
+	CleanupLastDeleted prometheus.Gauge
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "arkdrop_http_requests_total",
+			Help: "Total number of HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+
+		HTTPDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "arkdrop_http_request_duration_seconds",
+			Help:    "HTTP request latency by route and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+
+		UploadBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "arkdrop_upload_bytes_total",
+			Help: "Total bytes of attachments uploaded.",
+		}),
+
+		DownloadBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "arkdrop_download_bytes_total",
+			Help: "Total bytes of attachments served, by source.",
+		}, []string{"source"}),
+
+		ShareLinksCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "arkdrop_share_links_created_total",
+			Help: "Total number of attachment share links created.",
+		}),
+
+		ShareLinkHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "arkdrop_share_link_hits_total",
+			Help: "Total number of share link requests by result.",
+		}, []string{"result"}),
+
+		CleanupDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "arkdrop_cleanup_duration_seconds",
+			Help:    "Duration of expired parcel cleanup runs.",
+			Buckets: prometheus.DefBuckets,
+		}),
+
+		CleanupDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "arkdrop_cleanup_deleted_parcels_total",
+			Help: "Total number of parcels deleted by expiry cleanup.",
+		}),
+
+		CleanupLastDeleted: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "arkdrop_cleanup_last_deleted_parcels",
+			Help: "Number of parcels deleted by the most recent expiry cleanup run.",
+		}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.HTTPRequests,
+		m.HTTPDuration,
+		m.UploadBytes,
+		m.DownloadBytes,
+		m.ShareLinksCreated,
+		m.ShareLinkHits,
+		m.CleanupDuration,
+		m.CleanupDeleted,
+		m.CleanupLastDeleted,
+	)
+	return m
+}
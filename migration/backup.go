@@ -0,0 +1,168 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Backup copies the database into dir, naming the copy after its schema
+// version. SQLite is copied with VACUUM INTO, which gives a consistent snapshot
+// even with WAL in use. PostgreSQL is dumped with pg_dump, failing with
+// exec.ErrNotFound when it is not installed.
+func Backup(db *gorm.DB, dir string, version int) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("arkdrop-v%d-%s", version, time.Now().Format("20060102-150405"))
+
+	switch dialector := db.Dialector.(type) {
+	case *postgres.Dialector:
+		pgDump, err := exec.LookPath("pg_dump")
+		if err != nil {
+			return "", err
+		}
+		// The password goes in the environment, where other users can't read
+		// it, rather than on the command line.
+		dsn, password, err := splitPassword(dialector.Config.DSN)
+		if err != nil {
+			return "", err
+		}
+		path := filepath.Join(dir, name+".dump")
+		cmd := exec.Command(pgDump, "--format=custom", "--file="+path, "--dbname="+dsn)
+		if password != "" {
+			cmd.Env = append(os.Environ(), "PGPASSWORD="+password)
+		}
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("pg_dump: %w: %s", err, out)
+		}
+		return path, nil
+	default:
+		path := filepath.Join(dir, name+".db")
+		if err := db.Exec("VACUUM INTO ?", path).Error; err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+// splitPassword takes the password out of a PostgreSQL connection string in
+// URL or keyword/value form, returning the rest of the string and the password.
+func splitPassword(dsn string) (string, string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			// Unwrapped, the error doesn't repeat the url and its password.
+			return "", "", fmt.Errorf("parse database url: %w", errors.Unwrap(err))
+		}
+		var password string
+		if u.User != nil {
+			password, _ = u.User.Password()
+			u.User = url.User(u.User.Username())
+		}
+		// Parameters override the user info, as they do in libpq.
+		if query := u.Query(); query.Has("password") {
+			password = query.Get("password")
+			query.Del("password")
+			u.RawQuery = query.Encode()
+		}
+		return u.String(), password, nil
+	}
+
+	var (
+		kept     []string
+		password string
+	)
+	rest := dsn
+	for {
+		rest = strings.TrimLeft(rest, " \t\n\r")
+		if rest == "" {
+			break
+		}
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return "", "", errors.New("parse database connection string: expected key=value")
+		}
+		key := strings.TrimSpace(rest[:eq])
+		rest = strings.TrimLeft(rest[eq+1:], " \t\n\r")
+
+		var value strings.Builder
+		quoted := strings.HasPrefix(rest, "'")
+		if quoted {
+			rest = rest[1:]
+		}
+		i, closed := 0, !quoted
+		for ; i < len(rest); i++ {
+			ch := rest[i]
+			if ch == '\\' && i+1 < len(rest) {
+				i++
+				value.WriteByte(rest[i])
+				continue
+			}
+			if quoted && ch == '\'' {
+				closed = true
+				i++
+				break
+			}
+			if !quoted && strings.IndexByte(" \t\n\r", ch) >= 0 {
+				break
+			}
+			value.WriteByte(ch)
+		}
+		if !closed {
+			return "", "", fmt.Errorf("parse database connection string: unterminated quote in %s", key)
+		}
+		rest = rest[i:]
+
+		if key == "password" {
+			password = value.String()
+			continue
+		}
+		escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value.String())
+		kept = append(kept, key+"='"+escaped+"'")
+	}
+	return strings.Join(kept, " "), password, nil
+}
+
+// ErrNoBackup stops a migration that can't back up PostgreSQL because pg_dump is not installed.
+var ErrNoBackup = errors.New("pg_dump not found, install it or set migrate_without_backup to migrate without a backup")
+
+// Migrate moves the schema to version target, backing the database up into
+// backupDir first. Without pg_dump, PostgreSQL is only migrated when
+// withoutBackup allows it.
+func Migrate(db *gorm.DB, backupDir string, target int, withoutBackup bool) error {
+	current, err := Check(db)
+	if err != nil || current == target {
+		return err
+	}
+	// A new database has nothing worth keeping. Version 0 with tables is one
+	// created by AutoMigrate before schema versioning.
+	if current > 0 || db.Migrator().HasTable("parcels") {
+		path, err := Backup(db, backupDir, current)
+		switch {
+		case errors.Is(err, exec.ErrNotFound) && withoutBackup:
+			// PostgreSQL rolls back a failed migration with its transaction.
+			logrus.Warnln("pg_dump not found, migrating without a backup.")
+		case errors.Is(err, exec.ErrNotFound):
+			return ErrNoBackup
+		case err != nil:
+			return fmt.Errorf("back up database before migrating: %w", err)
+		default:
+			logrus.Infoln("Database backed up to", path)
+		}
+	}
+	if target > current {
+		return Up(db, target)
+	}
+	return Down(db, target)
+}
@@ -0,0 +1,32 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitPassword(t *testing.T) {
+	for _, tt := range []struct {
+		dsn, rest, password string
+	}{
+		{"postgres://arkdrop:s3cret@db:5432/arkdrop?sslmode=disable", "postgres://arkdrop@db:5432/arkdrop?sslmode=disable", "s3cret"},
+		{"postgresql://arkdrop@db/arkdrop?password=s3cret&sslmode=disable", "postgresql://arkdrop@db/arkdrop?sslmode=disable", "s3cret"},
+		{"postgres://db/arkdrop", "postgres://db/arkdrop", ""},
+		{"host=db user=arkdrop password=s3cret dbname=arkdrop", "host='db' user='arkdrop' dbname='arkdrop'", "s3cret"},
+		{`host = db password = 'it\'s \\ ok' dbname='ark drop'`, `host='db' dbname='ark drop'`, `it's \ ok`},
+		{"host=db", "host='db'", ""},
+	} {
+		rest, password, err := splitPassword(tt.dsn)
+		if err != nil || rest != tt.rest || password != tt.password {
+			t.Errorf("splitPassword(%q) = %q, %q, %v, want %q, %q", tt.dsn, rest, password, err, tt.rest, tt.password)
+		}
+	}
+
+	for _, dsn := range []string{"host=db password='s3cret", "s3cret", "postgres://arkdrop:s3cret@db:bad/arkdrop"} {
+		if _, _, err := splitPassword(dsn); err == nil {
+			t.Errorf("splitPassword(%q) succeeded, want an error", dsn)
+		} else if strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("splitPassword(%q) error %q repeats the password", dsn, err)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package migration
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Migration is one numbered schema change. Up and Down run in a transaction
+// together with the schema_migrations bookkeeping.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// State tells whether a migration has been applied to a database.
+type State struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+	// Unknown marks versions applied by a newer binary.
+	Unknown bool
+}
+
+func (s State) Applied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+// NewerSchemaError is returned for a database migrated by a newer binary.
+type NewerSchemaError struct {
+	Current int
+	Latest  int
+}
+
+func (e *NewerSchemaError) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than the %d this binary supports; "+
+		"upgrade arkdrop, or roll back with the newer binary's migrate down", e.Current, e.Latest)
+}
+
+// SQL migrations live in one directory per dialect, named as gorm names the
+// dialect. Every dialect has the same numbered migrations.
+//
+//go:embed sqlite/*.sql postgres/*.sql
+var sqlFiles embed.FS
+
+var dialects = []string{"sqlite", "postgres"}
+
+// goMigrations holds changes SQL can't express, such as backfills computed in
+// Go or conditional columns. They run on every dialect.
+var goMigrations = []Migration{parcelDevices}
+
+var sqlFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+const createVersionTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version integer PRIMARY KEY,
+	name text NOT NULL,
+	applied_at bigint NOT NULL
+)`
+
+var migrations = func() map[string][]Migration {
+	all := make(map[string][]Migration, len(dialects))
+	for _, dialect := range dialects {
+		all[dialect] = loadMigrations(dialect)
+		if len(all[dialect]) != len(all[dialects[0]]) {
+			panic(fmt.Sprintf("%s has %d migrations, %s has %d",
+				dialect, len(all[dialect]), dialects[0], len(all[dialects[0]])))
+		}
+	}
+	return all
+}()
+
+func loadMigrations(dialect string) []Migration {
+	byVersion := make(map[int]*Migration)
+	for _, m := range goMigrations {
+		byVersion[m.Version] = &m
+	}
+
+	entries, err := fs.ReadDir(sqlFiles, dialect)
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		match := sqlFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			panic("malformed migration file name " + dialect + "/" + entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := sqlFiles.ReadFile(dialect + "/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			panic(fmt.Sprintf("migration %d is named both %s and %s", version, m.Name, match[2]))
+		}
+		if match[3] == "up" {
+			m.Up = execSQL(string(data))
+		} else {
+			m.Down = execSQL(string(data))
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i, m := range list {
+		if m.Version != i+1 {
+			panic(fmt.Sprintf("%s migration %d is missing", dialect, i+1))
+		}
+		if m.Up == nil {
+			panic(fmt.Sprintf("%s migration %d has no up step", dialect, m.Version))
+		}
+	}
+	return list
+}
+
+// migrationsFor returns the migrations for the dialect db is connected with.
+func migrationsFor(db *gorm.DB) ([]Migration, error) {
+	list, ok := migrations[db.Dialector.Name()]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for database %s", db.Dialector.Name())
+	}
+	return list, nil
+}
+
+func execSQL(script string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Exec(script).Error
+	}
+}
+
+// Latest is the newest schema version this binary knows.
+func Latest() int {
+	return len(migrations[dialects[0]])
+}
+
+// Current returns the schema version of db, 0 for a database never migrated.
+func Current(db *gorm.DB) (int, error) {
+	if err := db.Exec(createVersionTable).Error; err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.Raw("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version).Error
+	return version, err
+}
+
+// Check returns the schema version of db, failing with a NewerSchemaError
+// when the binary is too old for it.
+func Check(db *gorm.DB) (int, error) {
+	current, err := Current(db)
+	if err != nil {
+		return 0, err
+	}
+	if current > Latest() {
+		return current, &NewerSchemaError{Current: current, Latest: Latest()}
+	}
+	return current, nil
+}
+
+// Status lists the known migrations and any applied by a newer binary, oldest first.
+func Status(db *gorm.DB) ([]State, error) {
+	list, err := migrationsFor(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Exec(createVersionTable).Error; err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Version   int
+		Name      string
+		AppliedAt int64
+	}
+	if err := db.Raw("SELECT version, name, applied_at FROM schema_migrations ORDER BY version").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	states := make([]State, 0, len(list))
+	for _, m := range list {
+		states = append(states, State{Version: m.Version, Name: m.Name})
+	}
+	for _, row := range rows {
+		if row.Version >= 1 && row.Version <= len(states) {
+			states[row.Version-1].AppliedAt = time.Unix(row.AppliedAt, 0)
+			continue
+		}
+		states = append(states, State{
+			Version:   row.Version,
+			Name:      row.Name,
+			AppliedAt: time.Unix(row.AppliedAt, 0),
+			Unknown:   true,
+		})
+	}
+	return states, nil
+}
+
+// Up applies the migrations after the current version up to target.
+func Up(db *gorm.DB, target int) error {
+	list, err := migrationsFor(db)
+	if err != nil {
+		return err
+	}
+	current, err := Check(db)
+	if err != nil {
+		return err
+	}
+	if target > Latest() {
+		return fmt.Errorf("unknown schema version %d, latest is %d", target, Latest())
+	}
+	for _, m := range list[current:target] {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				m.Version, m.Name, time.Now().Unix()).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		logrus.Infoln("Applied migration", m.Version, m.Name)
+	}
+	return nil
+}
+
+// Down rolls back the applied migrations newer than target, newest first.
+func Down(db *gorm.DB, target int) error {
+	list, err := migrationsFor(db)
+	if err != nil {
+		return err
+	}
+	current, err := Check(db)
+	if err != nil {
+		return err
+	}
+	if target < 0 {
+		return fmt.Errorf("invalid schema version %d", target)
+	}
+	for version := current; version > target; version-- {
+		m := list[version-1]
+		if m.Down == nil {
+			return fmt.Errorf("migration %d %s cannot be rolled back", m.Version, m.Name)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("roll back migration %d %s: %w", m.Version, m.Name, err)
+		}
+		logrus.Infoln("Rolled back migration", m.Version, m.Name)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var latestTables = []string{
+	"parcels", "attachments", "attachment_shares", "audit_events", "settings", "recovery_codes",
+	"passkeys", "pairing_codes", "devices", "hub_events", "channels", "clipboard_entries", "auth_sessions",
+}
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "arkdrop.db")), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestUpDownSQLite(t *testing.T) {
+	db := openSQLite(t)
+	if err := Up(db, Latest()); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range latestTables {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("table %s missing after up", table)
+		}
+	}
+
+	if err := Down(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range latestTables {
+		if db.Migrator().HasTable(table) {
+			t.Errorf("table %s left after down", table)
+		}
+	}
+
+	// Every down step must leave a schema its up step can be applied to again.
+	if err := Up(db, Latest()); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := Current(db); err != nil || current != Latest() {
+		t.Fatalf("current = %d, %v, want %d", current, err, Latest())
+	}
+}
+
+func TestUpgradeBaselineSQLite(t *testing.T) {
+	db := openSQLite(t)
+	schema, err := os.ReadFile("testdata/baseline.sqlite.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(string(schema)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO parcels (created_at, updated_at, favorite, content) VALUES (1, 1, 1, 'kept')").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	backupDir := t.TempDir()
+	if err := Migrate(db, backupDir, Latest(), false); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := filepath.Glob(filepath.Join(backupDir, "arkdrop-v0-*.db")); len(backups) != 1 {
+		t.Errorf("backups = %v, want one of version 0", backups)
+	}
+
+	var parcel struct {
+		Content  string
+		Favorite bool
+		// Added by the migrations with an empty default.
+		TransferID     string
+		TargetDeviceID string
+	}
+	if err := db.Raw("SELECT content, favorite, transfer_id, target_device_id FROM parcels").Scan(&parcel).Error; err != nil {
+		t.Fatal(err)
+	}
+	if parcel.Content != "kept" || !parcel.Favorite || parcel.TransferID != "" || parcel.TargetDeviceID != "" {
+		t.Errorf("parcel after upgrade = %+v", parcel)
+	}
+	for _, table := range latestTables {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("table %s missing after upgrade", table)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package migration
+
+import "gorm.io/gorm"
+
+// parcelDevices adds the device and transfer columns of parcels. Development
+// builds between the AutoMigrate releases and versioned migrations may have
+// added some already, and SQLite has no ADD COLUMN IF NOT EXISTS.
+var parcelDevices = Migration{
+	Version: 2,
+	Name:    "parcel_devices",
+	Up: func(tx *gorm.DB) error {
+		for _, column := range []string{"source_device_id", "target_device_id", "transfer_id"} {
+			if tx.Migrator().HasColumn("parcels", column) {
+				continue
+			}
+			if err := tx.Exec("ALTER TABLE parcels ADD COLUMN " + column + " text NOT NULL DEFAULT ''").Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec(`CREATE INDEX IF NOT EXISTS idx_parcels_transfer_id ON parcels (transfer_id);
+CREATE INDEX IF NOT EXISTS idx_parcels_target_device_id ON parcels (target_device_id);`).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Exec(`DROP INDEX IF EXISTS idx_parcels_target_device_id;
+DROP INDEX IF EXISTS idx_parcels_transfer_id;
+ALTER TABLE parcels DROP COLUMN transfer_id;
+ALTER TABLE parcels DROP COLUMN target_device_id;
+ALTER TABLE parcels DROP COLUMN source_device_id;`).Error
+	},
+}
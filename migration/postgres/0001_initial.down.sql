@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS attachment_shares;
+DROP TABLE IF EXISTS attachments;
+DROP TABLE IF EXISTS parcels;
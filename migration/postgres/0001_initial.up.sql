@@ -0,0 +1,29 @@
+CREATE TABLE parcels (
+	id bigserial PRIMARY KEY,
+	created_at bigint,
+	updated_at bigint,
+	favorite boolean,
+	content text
+);
+
+CREATE TABLE attachments (
+	id bigserial PRIMARY KEY,
+	created_at bigint,
+	updated_at bigint,
+	parcel_id bigint,
+	content_type text,
+	file_size bigint,
+	file_name text,
+	file_path text,
+	CONSTRAINT fk_parcels_attachments FOREIGN KEY (parcel_id) REFERENCES parcels (id)
+);
+
+CREATE TABLE attachment_shares (
+	token text PRIMARY KEY,
+	created_at bigint,
+	updated_at bigint,
+	attachment_id bigint,
+	expires_at bigint
+);
+CREATE INDEX idx_attachment_shares_expires_at ON attachment_shares (expires_at);
+CREATE INDEX idx_attachment_shares_attachment_id ON attachment_shares (attachment_id);
@@ -0,0 +1,103 @@
+-- Tables added after the first release, rerunnable like the SQLite version.
+CREATE TABLE IF NOT EXISTS audit_events (
+	id bigserial PRIMARY KEY,
+	created_at bigint,
+	type text,
+	target_id bigint,
+	remote_ip text,
+	user_agent text,
+	detail text
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_type ON audit_events (type);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+-- The audit log is append-only at the database level. Row triggers don't
+-- see TRUNCATE, so it gets a statement trigger of its own.
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS audit_events_no_update ON audit_events;
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+DROP TRIGGER IF EXISTS audit_events_no_delete ON audit_events;
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TABLE IF NOT EXISTS settings (
+	key text PRIMARY KEY,
+	updated_at bigint,
+	value text
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id bigserial PRIMARY KEY,
+	created_at bigint,
+	code_hash text,
+	used_at bigint
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recovery_codes_code_hash ON recovery_codes (code_hash);
+
+CREATE TABLE IF NOT EXISTS passkeys (
+	id bigserial PRIMARY KEY,
+	created_at bigint,
+	updated_at bigint,
+	name text,
+	credential_id text,
+	credential text,
+	last_used_at bigint
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_passkeys_credential_id ON passkeys (credential_id);
+
+CREATE TABLE IF NOT EXISTS pairing_codes (
+	id bigserial PRIMARY KEY,
+	created_at bigint,
+	code text,
+	token text,
+	expires_at bigint,
+	used_at bigint,
+	used_by text
+);
+CREATE INDEX IF NOT EXISTS idx_pairing_codes_expires_at ON pairing_codes (expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pairing_codes_token ON pairing_codes (token);
+CREATE INDEX IF NOT EXISTS idx_pairing_codes_code ON pairing_codes (code);
+
+CREATE TABLE IF NOT EXISTS devices (
+	id text PRIMARY KEY,
+	created_at bigint,
+	updated_at bigint,
+	name text,
+	last_seen_at bigint
+);
+
+CREATE TABLE IF NOT EXISTS hub_events (
+	seq bigserial PRIMARY KEY,
+	created_at bigint,
+	channel text,
+	source_device_id text,
+	target_device_id text,
+	msg_type integer,
+	payload bytea
+);
+CREATE INDEX IF NOT EXISTS idx_hub_events_target_device_id ON hub_events (target_device_id);
+CREATE INDEX IF NOT EXISTS idx_hub_events_channel ON hub_events (channel);
+CREATE INDEX IF NOT EXISTS idx_hub_events_created_at ON hub_events (created_at);
+
+CREATE TABLE IF NOT EXISTS channels (
+	name text PRIMARY KEY,
+	created_at bigint,
+	updated_at bigint,
+	allowed_devices text NOT NULL DEFAULT '',
+	max_message_size bigint,
+	rate_limit integer
+);
+
+CREATE TABLE IF NOT EXISTS clipboard_entries (
+	channel text PRIMARY KEY,
+	updated_at bigint,
+	seq bigint,
+	message text
+);
@@ -0,0 +1,7 @@
+-- Login flow state, shared by every instance using the database.
+CREATE TABLE auth_sessions (
+	key text PRIMARY KEY,
+	data text,
+	expires_at bigint
+);
+CREATE INDEX idx_auth_sessions_expires_at ON auth_sessions (expires_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_parcels_transfer_id;
+CREATE INDEX idx_parcels_transfer_id ON parcels (transfer_id);
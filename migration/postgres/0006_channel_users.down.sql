@@ -0,0 +1 @@
+ALTER TABLE channels DROP COLUMN allowed_users;
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS `clipboard_entries`;
+DROP TABLE IF EXISTS `channels`;
+DROP TABLE IF EXISTS `hub_events`;
+DROP TABLE IF EXISTS `devices`;
+DROP TABLE IF EXISTS `pairing_codes`;
+DROP TABLE IF EXISTS `passkeys`;
+DROP TABLE IF EXISTS `recovery_codes`;
+DROP TABLE IF EXISTS `settings`;
+DROP TABLE IF EXISTS `audit_events`;
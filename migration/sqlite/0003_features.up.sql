@@ -0,0 +1,34 @@
+-- Tables added after the AutoMigrate releases. Development builds of that
+-- time may have created some of them already, hence IF NOT EXISTS.
+CREATE TABLE IF NOT EXISTS `audit_events` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` integer,`type` text,`target_id` integer,`remote_ip` text,`user_agent` text,`detail` text);
+CREATE INDEX IF NOT EXISTS `idx_audit_events_type` ON `audit_events`(`type`);
+CREATE INDEX IF NOT EXISTS `idx_audit_events_created_at` ON `audit_events`(`created_at`);
+-- The audit log is append-only at the database level.
+CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+
+CREATE TABLE IF NOT EXISTS `settings` (`key` text,`updated_at` integer,`value` text,PRIMARY KEY (`key`));
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` integer,`code_hash` text,`used_at` integer);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_recovery_codes_code_hash` ON `recovery_codes`(`code_hash`);
+
+CREATE TABLE IF NOT EXISTS `passkeys` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` integer,`updated_at` integer,`name` text,`credential_id` text,`credential` text,`last_used_at` integer);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_passkeys_credential_id` ON `passkeys`(`credential_id`);
+
+CREATE TABLE IF NOT EXISTS `pairing_codes` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` integer,`code` text,`token` text,`expires_at` integer,`used_at` integer,`used_by` text);
+CREATE INDEX IF NOT EXISTS `idx_pairing_codes_expires_at` ON `pairing_codes`(`expires_at`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_pairing_codes_token` ON `pairing_codes`(`token`);
+CREATE INDEX IF NOT EXISTS `idx_pairing_codes_code` ON `pairing_codes`(`code`);
+
+CREATE TABLE IF NOT EXISTS `devices` (`id` text,`created_at` integer,`updated_at` integer,`name` text,`last_seen_at` integer,PRIMARY KEY (`id`));
+
+CREATE TABLE IF NOT EXISTS `hub_events` (`seq` integer PRIMARY KEY AUTOINCREMENT,`created_at` integer,`channel` text,`source_device_id` text,`target_device_id` text,`msg_type` integer,`payload` blob);
+CREATE INDEX IF NOT EXISTS `idx_hub_events_target_device_id` ON `hub_events`(`target_device_id`);
+CREATE INDEX IF NOT EXISTS `idx_hub_events_channel` ON `hub_events`(`channel`);
+CREATE INDEX IF NOT EXISTS `idx_hub_events_created_at` ON `hub_events`(`created_at`);
+
+CREATE TABLE IF NOT EXISTS `channels` (`name` text,`created_at` integer,`updated_at` integer,`allowed_devices` text NOT NULL DEFAULT "",`max_message_size` integer,`rate_limit` integer,PRIMARY KEY (`name`));
+
+CREATE TABLE IF NOT EXISTS `clipboard_entries` (`channel` text,`updated_at` integer,`seq` integer,`message` text,PRIMARY KEY (`channel`));
@@ -0,0 +1,3 @@
+-- Login flow state, shared by every instance using the database.
+CREATE TABLE `auth_sessions` (`key` text,`data` text,`expires_at` integer,PRIMARY KEY (`key`));
+CREATE INDEX `idx_auth_sessions_expires_at` ON `auth_sessions`(`expires_at`);
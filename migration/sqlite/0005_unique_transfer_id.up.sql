@@ -0,0 +1,7 @@
+-- Two reports of one direct transfer could both insert a parcel before the
+-- unique index existed. Keep the first parcel as the record of the transfer.
+UPDATE parcels SET transfer_id = '' WHERE transfer_id <> '' AND id NOT IN (
+	SELECT MIN(id) FROM parcels WHERE transfer_id <> '' GROUP BY transfer_id
+);
+DROP INDEX IF EXISTS idx_parcels_transfer_id;
+CREATE UNIQUE INDEX idx_parcels_transfer_id ON parcels (transfer_id) WHERE transfer_id <> '';
@@ -0,0 +1,2 @@
+-- Channels admit the users of login sessions as well as devices.
+ALTER TABLE `channels` ADD COLUMN `allowed_users` text NOT NULL DEFAULT "";
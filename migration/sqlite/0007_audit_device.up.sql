@@ -0,0 +1,2 @@
+-- Audit events name the paired device that caused them.
+ALTER TABLE `audit_events` ADD COLUMN `device_id` text NOT NULL DEFAULT "";
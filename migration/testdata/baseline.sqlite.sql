@@ -0,0 +1,5 @@
+CREATE TABLE `parcels` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` integer,`updated_at` integer,`favorite` numeric,`content` text);
+CREATE TABLE `attachments` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` integer,`updated_at` integer,`parcel_id` integer,`content_type` text,`file_size` integer,`file_name` text,`file_path` text,CONSTRAINT `fk_parcels_attachments` FOREIGN KEY (`parcel_id`) REFERENCES `parcels`(`id`));
+CREATE TABLE `attachment_shares` (`token` text,`created_at` integer,`updated_at` integer,`attachment_id` integer,`expires_at` integer,PRIMARY KEY (`token`));
+CREATE INDEX `idx_attachment_shares_expires_at` ON `attachment_shares`(`expires_at`);
+CREATE INDEX `idx_attachment_shares_attachment_id` ON `attachment_shares`(`attachment_id`);
@@ -9,13 +9,15 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
 	"github.com/zjyl1994/arkdrop/service"
 	"github.com/zjyl1994/arkdrop/utils"
-	"github.com/zjyl1994/arkdrop/vars"
 	"gorm.io/gorm"
 )
 
-var parcelService service.ParcelService
+// uploadFormOverhead is the room left in an upload body for the multipart
+// boundaries and part headers around the files.
+const uploadFormOverhead = 64 << 10
 
 func buildAttachment(file *multipart.FileHeader, now int64) service.Attachment {
 	return service.Attachment{
@@ -27,7 +29,7 @@ func buildAttachment(file *multipart.FileHeader, now int64) service.Attachment {
 	}
 }
 
-func saveAttachments(c *fiber.Ctx, files []*multipart.FileHeader) ([]service.Attachment, []string, error) {
+func (s *Server) saveAttachments(c *fiber.Ctx, files []*multipart.FileHeader) ([]service.Attachment, []string, error) {
 	attachments := make([]service.Attachment, 0, len(files))
 	savedPaths := make([]string, 0, len(files))
 	now := time.Now().Unix()
@@ -38,8 +40,8 @@ func saveAttachments(c *fiber.Ctx, files []*multipart.FileHeader) ([]service.Att
 		}
 
 		diskFileName := utils.RandString(10) + filepath.Ext(file.Filename)
-		diskPath := filepath.Join(vars.DataDir, "files", diskFileName)
-		if err := c.SaveFile(file, diskPath); err != nil {
+		diskPath := filepath.Join(s.cfg.DataDir, "files", diskFileName)
+		if err := saveUploadedFile(c, file, diskPath); err != nil {
 			for _, savedPath := range savedPaths {
 				_ = os.Remove(savedPath)
 			}
@@ -55,6 +57,20 @@ func saveAttachments(c *fiber.Ctx, files []*multipart.FileHeader) ([]service.Att
 	return attachments, savedPaths, nil
 }
 
+// PartialUploadSuffix marks files still being written; New removes any left over.
+const PartialUploadSuffix = ".part"
+
+// saveUploadedFile writes under a temporary name first, so an interrupted
+// write never leaves a truncated file under the final name.
+func saveUploadedFile(c *fiber.Ctx, file *multipart.FileHeader, diskPath string) error {
+	partPath := diskPath + PartialUploadSuffix
+	if err := c.SaveFile(file, partPath); err != nil {
+		_ = os.Remove(partPath)
+		return err
+	}
+	return os.Rename(partPath, diskPath)
+}
+
 func cleanupSavedFiles(savedPaths []string) {
 	for _, savedPath := range savedPaths {
 		_ = os.Remove(savedPath)
@@ -75,9 +91,21 @@ func parseOptionalBoolQuery(c *fiber.Ctx, key string) (*bool, error) {
 	return &parsedValue, nil
 }
 
-func CreateParcel(c *fiber.Ctx) (err error) {
+func (s *Server) CreateParcel(c *fiber.Ctx) (err error) {
 	var parcel service.Parcel
 	parcel.Content = c.FormValue("content")
+	parcel.SourceDeviceID = currentDeviceID(c)
+	parcel.TargetDeviceID = c.FormValue("target_device")
+	if parcel.TargetDeviceID != "" {
+		if _, err := s.deviceService.Get(parcel.TargetDeviceID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"message": "unknown target device",
+				})
+			}
+			return err
+		}
+	}
 	rawFavorite := c.FormValue("favorite")
 	if rawFavorite != "" {
 		parcel.Favorite, err = strconv.ParseBool(rawFavorite)
@@ -91,17 +119,24 @@ func CreateParcel(c *fiber.Ctx) (err error) {
 	parcel.CreatedAt = now
 	parcel.UpdatedAt = now
 
-	parcel, err = parcelService.Create(parcel)
+	parcel, err = s.parcelService.Create(parcel)
 	if err != nil {
 		return err
 	}
+	s.recordAudit(c, service.AuditParcelCreate, parcel.ID, map[string]any{
+		"favorite":      parcel.Favorite,
+		"target_device": parcel.TargetDeviceID,
+	})
+	if parcel.TargetDeviceID != "" {
+		s.sendToDevice(parcel.TargetDeviceID, websocket.TextMessage, []byte("list_change"))
+	}
 
 	return c.JSON(fiber.Map{
 		"id": parcel.ID,
 	})
 }
 
-func AddParcelAttachment(c *fiber.Ctx) error {
+func (s *Server) AddParcelAttachment(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Query("id"))
 	if err != nil || id <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -109,6 +144,13 @@ func AddParcelAttachment(c *fiber.Ctx) error {
 		})
 	}
 
+	limit := s.store.CurrentSettings().UploadLimit
+	// Turn away uploads that can't fit before parsing them. The body holds the
+	// multipart framing too, so it may exceed the files by uploadFormOverhead.
+	if size := c.Request().Header.ContentLength(); size > 0 && int64(size) > limit+uploadFormOverhead {
+		return uploadTooLarge(c, limit)
+	}
+
 	form, err := c.MultipartForm()
 	if err != nil {
 		return err
@@ -120,13 +162,20 @@ func AddParcelAttachment(c *fiber.Ctx) error {
 			"message": "missing file",
 		})
 	}
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file.Size
+	}
+	if totalSize > limit {
+		return uploadTooLarge(c, limit)
+	}
 
-	attachments, savedPaths, err := saveAttachments(c, files)
+	attachments, savedPaths, err := s.saveAttachments(c, files)
 	if err != nil {
 		return err
 	}
 
-	err = parcelService.AddAttachments(id, attachments)
+	err = s.parcelService.AddAttachments(id, attachments)
 	if err != nil {
 		cleanupSavedFiles(savedPaths)
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -137,12 +186,28 @@ func AddParcelAttachment(c *fiber.Ctx) error {
 		return err
 	}
 
+	fileNames := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		s.metrics.UploadBytes.Add(float64(attachment.FileSize))
+		fileNames = append(fileNames, attachment.FileName)
+	}
+	s.recordAudit(c, service.AuditAttachmentAdd, id, map[string]any{
+		"files": fileNames,
+	})
+
 	return c.JSON(fiber.Map{
 		"count": len(attachments),
 	})
 }
 
-func ListParcel(c *fiber.Ctx) error {
+func uploadTooLarge(c *fiber.Ctx, limit int64) error {
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+		"message":      "upload too large",
+		"upload_limit": limit,
+	})
+}
+
+func (s *Server) ListParcel(c *fiber.Ctx) error {
 	favorite, err := parseOptionalBoolQuery(c, "favorite")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -150,29 +215,30 @@ func ListParcel(c *fiber.Ctx) error {
 		})
 	}
 
-	parcels, err := parcelService.List(favorite)
+	parcels, err := s.parcelService.List(favorite, currentDeviceID(c))
 	if err != nil {
 		return err
 	}
 	return c.JSON(fiber.Map{
-		"expire_seconds": int(vars.AutoExpire.Seconds()),
+		"expire_seconds": int(s.store.CurrentSettings().AutoExpire.Seconds()),
 		"list":           parcels,
 	})
 }
 
-func DeleteParcel(c *fiber.Ctx) error {
+func (s *Server) DeleteParcel(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Query("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
-	err = parcelService.Delete(id)
+	err = s.parcelService.Delete(id)
 	if err != nil {
 		return err
 	}
+	s.recordAudit(c, service.AuditParcelDelete, id, nil)
 	return c.SendString("OK")
 }
 
-func CleanParcel(c *fiber.Ctx) error {
+func (s *Server) CleanParcel(c *fiber.Ctx) error {
 	favorite, err := parseOptionalBoolQuery(c, "favorite")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -185,21 +251,41 @@ func CleanParcel(c *fiber.Ctx) error {
 		shouldCleanFavorite = *favorite
 	}
 
-	err = parcelService.Clean(shouldCleanFavorite)
+	deletedIDs, err := s.parcelService.Clean(shouldCleanFavorite)
+	if len(deletedIDs) > 0 || err == nil {
+		s.recordAudit(c, service.AuditParcelClean, 0, map[string]any{
+			"favorite":   shouldCleanFavorite,
+			"parcel_ids": deletedIDs,
+		})
+	}
 	if err != nil {
 		return err
 	}
 	return c.SendString("OK")
 }
 
-func FavoriteParcel(c *fiber.Ctx) error {
+func (s *Server) FavoriteParcel(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Query("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
-	err = parcelService.Favorite(id)
+	err = s.parcelService.Favorite(id)
 	if err != nil {
 		return err
 	}
+	s.recordAudit(c, service.AuditParcelFavorite, id, nil)
 	return c.SendString("OK")
 }
+
+// FilesCacheControl lets browsers cache files until their parcel may expire,
+// following auto_expire as it changes at runtime.
+func (s *Server) FilesCacheControl(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		return err
+	}
+	if c.Response().StatusCode() == fiber.StatusOK {
+		maxAge := int(s.store.CurrentSettings().AutoExpire.Seconds())
+		c.Set(fiber.HeaderCacheControl, "public, max-age="+strconv.Itoa(maxAge))
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zjyl1994/arkdrop/config"
+)
+
+func TestUploadLimit(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.UploadLimit = 1 << 10 })
+	admin := s.testToken(t, "", adminUser)
+	resp := s.request(t, http.MethodPost, "/api/create", admin, url.Values{"content": {"files"}})
+	expectStatus(t, resp, http.StatusOK)
+	target := "/api/attachment?id=1"
+
+	upload := func(body []byte, contentType string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", admin)
+		return s.do(t, req)
+	}
+	form := func(size int) ([]byte, string) {
+		t.Helper()
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		part, err := w.CreateFormFile("file", "data-"+strconv.Itoa(size)+".bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write(bytes.Repeat([]byte{'x'}, size))
+		_ = w.Close()
+		return body.Bytes(), w.FormDataContentType()
+	}
+
+	expectStatus(t, upload(form(1<<10)), http.StatusOK)
+	expectStatus(t, upload(form(1<<10+1)), http.StatusRequestEntityTooLarge)
+
+	// A body far beyond the limit is refused by its Content-Length, before
+	// it is parsed: this one isn't even a valid form.
+	junk := []byte(strings.Repeat("x", 1<<10+uploadFormOverhead+1))
+	expectStatus(t, upload(junk, "multipart/form-data; boundary=none"), http.StatusRequestEntityTooLarge)
+}
@@ -10,28 +10,28 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/zjyl1994/arkdrop/service"
-	"github.com/zjyl1994/arkdrop/vars"
 	"gorm.io/gorm"
 )
 
-func loadAttachmentWithParcel(id int) (service.Attachment, service.Parcel, error) {
+func (s *Server) loadAttachmentWithParcel(id int) (service.Attachment, service.Parcel, error) {
 	var attachment service.Attachment
-	if err := vars.DB.First(&attachment, id).Error; err != nil {
+	if err := s.store.DB.First(&attachment, id).Error; err != nil {
 		return service.Attachment{}, service.Parcel{}, err
 	}
 
 	var parcel service.Parcel
-	if err := vars.DB.Select("id", "created_at", "favorite").First(&parcel, attachment.ParcelID).Error; err != nil {
+	if err := s.store.DB.Select("id", "created_at", "favorite").First(&parcel, attachment.ParcelID).Error; err != nil {
 		return service.Attachment{}, service.Parcel{}, err
 	}
 
 	return attachment, parcel, nil
 }
 
-func getAttachmentShareExpiresAt(parcel service.Parcel, now time.Time) int64 {
-	expiresAt := now.Add(vars.AttachmentLinkExpire).Unix()
+func (s *Server) getAttachmentShareExpiresAt(parcel service.Parcel, now time.Time) int64 {
+	settings := s.store.CurrentSettings()
+	expiresAt := now.Add(settings.AttachmentLinkExpire).Unix()
 	if !parcel.Favorite {
-		parcelExpiresAt := parcel.CreatedAt + int64(vars.AutoExpire.Seconds())
+		parcelExpiresAt := parcel.CreatedAt + int64(settings.AutoExpire.Seconds())
 		if parcelExpiresAt < expiresAt {
 			expiresAt = parcelExpiresAt
 		}
@@ -39,7 +39,7 @@ func getAttachmentShareExpiresAt(parcel service.Parcel, now time.Time) int64 {
 	return expiresAt
 }
 
-func CreateAttachmentShareLink(c *fiber.Ctx) error {
+func (s *Server) CreateAttachmentShareLink(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Query("id"))
 	if err != nil || id <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -47,7 +47,7 @@ func CreateAttachmentShareLink(c *fiber.Ctx) error {
 		})
 	}
 
-	attachment, parcel, err := loadAttachmentWithParcel(id)
+	attachment, parcel, err := s.loadAttachmentWithParcel(id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -58,64 +58,83 @@ func CreateAttachmentShareLink(c *fiber.Ctx) error {
 	}
 
 	now := time.Now()
-	expiresAt := getAttachmentShareExpiresAt(parcel, now)
+	expiresAt := s.getAttachmentShareExpiresAt(parcel, now)
 	if expiresAt <= now.Unix() {
 		return c.Status(fiber.StatusGone).JSON(fiber.Map{
 			"message": "attachment already expired",
 		})
 	}
 
-	share, err := parcelService.GetOrCreateAttachmentShare(attachment.ID, expiresAt)
+	share, err := s.parcelService.GetOrCreateAttachmentShare(attachment.ID, expiresAt)
 	if err != nil {
 		return err
 	}
 
-	sharePath := fmt.Sprintf("/share/files/%s", share.Token)
+	sharePath := fmt.Sprintf("%s/share/files/%s", s.cfg.BasePath, share.Token)
+	s.recordAudit(c, service.AuditShareCreate, attachment.ID, map[string]any{
+		"parcel_id":  attachment.ParcelID,
+		"expires_at": share.ExpiresAt,
+	})
 
-	return c.JSON(fiber.Map{
+	result := fiber.Map{
 		"path":               sharePath,
 		"expires_at":         share.ExpiresAt,
 		"expires_in_seconds": share.ExpiresAt - now.Unix(),
-	})
+	}
+	// public_url already ends with base_path.
+	if s.cfg.PublicURL != "" {
+		result["url"] = s.cfg.PublicURL + "/share/files/" + share.Token
+	}
+	return c.JSON(result)
 }
 
-func DownloadSharedAttachment(c *fiber.Ctx) error {
+func (s *Server) DownloadSharedAttachment(c *fiber.Ctx) error {
 	token := c.Params("token")
 	if token == "" {
 		return c.Status(fiber.StatusBadRequest).SendString("missing share token")
 	}
 
 	var share service.AttachmentShare
-	if err := vars.DB.First(&share, "token = ?", token).Error; err != nil {
+	if err := s.store.DB.First(&share, "token = ?", token).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.shareGuard.fail(s.clientIP(c))
+			s.metrics.ShareLinkHits.WithLabelValues("not_found").Inc()
 			return c.Status(fiber.StatusNotFound).SendString("attachment not found")
 		}
 		return err
 	}
 
 	if time.Now().Unix() > share.ExpiresAt {
-		_ = vars.DB.Delete(&share).Error
+		_ = s.store.DB.Delete(&share).Error
+		s.metrics.ShareLinkHits.WithLabelValues("expired").Inc()
 		return c.Status(fiber.StatusGone).SendString("link expired")
 	}
 
 	var attachment service.Attachment
-	if err := vars.DB.First(&attachment, share.AttachmentID).Error; err != nil {
-		_ = vars.DB.Delete(&share).Error
+	if err := s.store.DB.First(&attachment, share.AttachmentID).Error; err != nil {
+		_ = s.store.DB.Delete(&share).Error
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.metrics.ShareLinkHits.WithLabelValues("not_found").Inc()
 			return c.Status(fiber.StatusNotFound).SendString("attachment not found")
 		}
 		return err
 	}
 
-	diskPath := filepath.Join(vars.DataDir, "files", attachment.FilePath)
+	diskPath := filepath.Join(s.cfg.DataDir, "files", attachment.FilePath)
 	if _, err := os.Stat(diskPath); err != nil {
-		_ = vars.DB.Delete(&share).Error
+		_ = s.store.DB.Delete(&share).Error
 		if errors.Is(err, os.ErrNotExist) {
+			s.metrics.ShareLinkHits.WithLabelValues("not_found").Inc()
 			return c.Status(fiber.StatusNotFound).SendString("attachment not found")
 		}
 		return err
 	}
 
+	s.metrics.ShareLinkHits.WithLabelValues("ok").Inc()
+	s.recordAudit(c, service.AuditShareDownload, attachment.ID, map[string]any{
+		"parcel_id": attachment.ParcelID,
+		"file_name": attachment.FileName,
+	})
 	c.Set(fiber.HeaderCacheControl, "private, no-store, max-age=0")
 	if attachment.ContentType != "" {
 		c.Set(fiber.HeaderContentType, attachment.ContentType)
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/service"
+	"github.com/zjyl1994/arkdrop/utils"
+)
+
+const (
+	defaultAuditQueryLimit = 100
+	maxAuditQueryLimit     = 1000
+)
+
+// recordAudit stores an audit event for the current request. Failures are
+// logged rather than returned so auditing never breaks the audited action.
+func (s *Server) recordAudit(c *fiber.Ctx, eventType string, targetID int, detail map[string]any) {
+	event := service.AuditEvent{
+		Type:      eventType,
+		TargetID:  targetID,
+		DeviceID:  currentDeviceID(c),
+		RemoteIP:  s.clientIP(c),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+	if err := s.auditService.Record(event, detail); err != nil {
+		logrus.Errorln("Record audit event failed:", err)
+	}
+}
+
+func parseAuditFilter(c *fiber.Ctx) (service.AuditFilter, error) {
+	var filter service.AuditFilter
+	filter.Types = utils.SplitList(c.Query("type"))
+
+	var err error
+	if rawSince := c.Query("since"); rawSince != "" {
+		if filter.Since, err = strconv.ParseInt(rawSince, 10, 64); err != nil {
+			return filter, err
+		}
+	}
+	if rawUntil := c.Query("until"); rawUntil != "" {
+		if filter.Until, err = strconv.ParseInt(rawUntil, 10, 64); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+func (s *Server) ListAuditEvents(c *fiber.Ctx) error {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "invalid audit filter",
+		})
+	}
+
+	filter.Limit = c.QueryInt("limit", defaultAuditQueryLimit)
+	if filter.Limit <= 0 || filter.Limit > maxAuditQueryLimit {
+		filter.Limit = maxAuditQueryLimit
+	}
+
+	events, err := s.auditService.Query(filter)
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{
+		"list": events,
+	})
+}
+
+func (s *Server) ExportAuditEvents(c *fiber.Ctx) error {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "invalid audit filter",
+		})
+	}
+
+	w := bufio.NewWriter(c)
+	encoder := json.NewEncoder(w)
+	err = s.auditService.Export(filter, func(events []service.AuditEvent) error {
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Attachment("arkdrop-audit.jsonl")
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	return w.Flush()
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/zjyl1994/arkdrop/service"
+)
+
+func TestAuditDevice(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := s.testToken(t, "", adminUser)
+	deviceID, device := s.registerTestDevice(t, "phone")
+
+	expectStatus(t, s.request(t, http.MethodPost, "/api/create", device, url.Values{"content": {"from the phone"}}), http.StatusOK)
+	expectStatus(t, s.request(t, http.MethodPost, "/api/create", admin, url.Values{"content": {"from the browser"}}), http.StatusOK)
+
+	resp := s.request(t, http.MethodGet, "/api/audit?type="+service.AuditParcelCreate, admin, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var body struct {
+		List []service.AuditEvent `json:"list"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	devices := map[string]int{}
+	for _, event := range body.List {
+		devices[event.DeviceID]++
+	}
+	if len(body.List) != 2 || devices[deviceID] != 1 || devices[""] != 1 {
+		t.Errorf("events by device = %v, want one from %s and one without a device", devices, deviceID)
+	}
+}
@@ -2,76 +2,257 @@ package server
 
 import (
 	"crypto/subtle"
+	"errors"
 	"time"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/service"
 	"github.com/zjyl1994/arkdrop/vars"
 	"github.com/zjyl1994/cap-go"
+	"gorm.io/gorm"
 )
 
-func LoginHandler(c *fiber.Ctx) error {
+// adminUser names the admin in the user claim of password and passkey sessions.
+const adminUser = "admin"
+
+func (s *Server) LoginHandler(c *fiber.Ctx) error {
 	inputPass := c.FormValue("password")
 	remember := c.FormValue("remember")
 	capToken := c.FormValue("cap_token")
 
 	// 验证CAP令牌
-	if capToken == "" || !vars.CapInstance.ValidateToken(capToken, false) {
+	if capToken == "" || !s.capInstance.ValidateToken(capToken, false) {
+		s.recordAudit(c, service.AuditLoginFailure, 0, map[string]any{"reason": "cap"})
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	if subtle.ConstantTimeCompare([]byte(inputPass), []byte(vars.Password)) == 0 {
+	passwordOK, err := s.checkPassword(inputPass)
+	if err != nil {
+		return err
+	}
+	if !passwordOK {
+		s.loginGuard.fail(s.clientIP(c))
+		s.recordAudit(c, service.AuditLoginFailure, 0, map[string]any{"reason": "password"})
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
+	twoFactorEnabled, err := s.twoFactorService.Enabled()
+	if err != nil {
+		return err
+	}
+	if twoFactorEnabled {
+		otpCode := c.FormValue("otp")
+		if otpCode == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message":      "one-time password required",
+				"otp_required": true,
+			})
+		}
+		if err := s.twoFactorService.Verify(otpCode); err != nil {
+			if !errors.Is(err, service.ErrInvalidOTP) {
+				return err
+			}
+			s.loginGuard.fail(s.clientIP(c))
+			s.recordAudit(c, service.AuditLoginFailure, 0, map[string]any{"reason": "otp"})
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message":      "invalid one-time password",
+				"otp_required": true,
+			})
+		}
+	}
+
+	tokenString, err := s.issueToken(c, remember == "1" || remember == "true", adminUser)
+	if err != nil {
+		return err
+	}
+	s.loginGuard.succeed(s.clientIP(c))
+	s.recordAudit(c, service.AuditLoginSuccess, 0, map[string]any{"method": "password"})
+	return c.SendString(tokenString)
+}
+
+// initSigningKey picks the JWT signing key. The configured password keeps doubling
+// as the key so existing sessions survive; otherwise a random secret is kept in the database.
+func (s *Server) initSigningKey() (err error) {
+	if s.cfg.Password != "" {
+		if weakness := service.PasswordWeakness(s.cfg.Password); weakness != "" {
+			logrus.Warnln("ARKDROP_PASSWORD is weak,", weakness+". Please choose a stronger one.")
+		}
+		s.jwtSecret = []byte(s.cfg.Password)
+		return nil
+	}
+	s.jwtSecret, err = s.adminService.SigningSecret()
+	return err
+}
+
+// checkPassword compares against ARKDROP_PASSWORD when it is set, otherwise
+// against the admin password stored by the first-run setup.
+func (s *Server) checkPassword(password string) (bool, error) {
+	if s.cfg.Password != "" {
+		return subtle.ConstantTimeCompare([]byte(password), []byte(s.cfg.Password)) == 1, nil
+	}
+	return s.adminService.VerifyPassword(password)
+}
+
+// issueToken signs a session JWT for user and sets it as the droptoken cookie.
+func (s *Server) issueToken(c *fiber.Ctx, remember bool, user string) (string, error) {
+	return s.signToken(c, tokenExpiry(remember), currentDeviceID(c), user)
+}
+
+func tokenExpiry(remember bool) time.Time {
 	// Default token expire duration
 	expireDuration := vars.JWT_TOKEN_EXPIRE
 	// If remember me is enabled, extend to one year
-	if remember == "1" || remember == "true" {
+	if remember {
 		expireDuration = 365 * 24 * time.Hour
 	}
-	exp := time.Now().Add(expireDuration)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"exp": exp.Unix(),
-		})
+	return time.Now().Add(expireDuration)
+}
+
+func (s *Server) signToken(c *fiber.Ctx, exp time.Time, deviceID, user string) (string, error) {
+	claims := jwt.MapClaims{
+		"exp": exp.Unix(),
+	}
+	if deviceID != "" {
+		claims["device_id"] = deviceID
+	}
+	if user != "" {
+		claims["user"] = user
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	tokenString, err := token.SignedString([]byte(vars.Password))
+	tokenString, err := token.SignedString(s.jwtSecret)
 	if err != nil {
-		return err
+		return "", err
+	}
+	s.setSessionCookies(c, tokenString, exp)
+	return tokenString, nil
+}
+
+// setSessionCookies stores the token in an HttpOnly cookie. Scripts only see
+// the companion droplogin flag telling the web UI a session exists.
+func (s *Server) setSessionCookies(c *fiber.Ctx, tokenString string, exp time.Time) {
+	secure := c.Protocol() == "https"
+	loggedIn := ""
+	if tokenString != "" {
+		loggedIn = "1"
 	}
 	c.Cookie(&fiber.Cookie{
-		Name:    "droptoken",
-		Value:   tokenString,
-		Expires: exp,
-		MaxAge:  int(expireDuration.Seconds()),
+		Name:     "droptoken",
+		Value:    tokenString,
+		Path:     s.cfg.BasePath + "/",
+		Expires:  exp,
+		MaxAge:   int(time.Until(exp).Seconds()),
+		Secure:   secure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
 	})
-	return c.SendString(tokenString)
+	c.Cookie(&fiber.Cookie{
+		Name:     "droplogin",
+		Value:    loggedIn,
+		Path:     s.cfg.BasePath + "/",
+		Expires:  exp,
+		MaxAge:   int(time.Until(exp).Seconds()),
+		Secure:   secure,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+func (s *Server) LogoutHandler(c *fiber.Ctx) error {
+	s.setSessionCookies(c, "", time.Unix(0, 0))
+	return c.SendString("OK")
 }
 
-func AuthMiddleware() fiber.Handler {
+// tokenDeviceID extracts the device claim from the JWT that AuthMiddleware stored in locals.
+func tokenDeviceID(user interface{}) string {
+	token, ok := user.(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	deviceID, _ := claims["device_id"].(string)
+	return deviceID
+}
+
+func currentDeviceID(c *fiber.Ctx) string {
+	return tokenDeviceID(c.Locals("user"))
+}
+
+// tokenUser extracts the user claim: adminUser for password and passkey
+// logins, the email or subject for OIDC ones, empty for paired devices.
+func tokenUser(user interface{}) string {
+	token, ok := user.(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	name, _ := claims["user"].(string)
+	return name
+}
+
+func currentUser(c *fiber.Ctx) string {
+	return tokenUser(c.Locals("user"))
+}
+
+var publicPaths = map[string]bool{
+	"/api/login":                true,
+	"/api/logout":               true,
+	"/api/health":               true,
+	"/api/setup":                true,
+	"/api/setup/status":         true,
+	"/api/cap/challenge":        true,
+	"/api/cap/redeem":           true,
+	"/api/oidc/config":          true,
+	"/api/oidc/login":           true,
+	"/api/oidc/callback":        true,
+	"/api/passkey/config":       true,
+	"/api/passkey/login/begin":  true,
+	"/api/passkey/login/finish": true,
+	"/api/pair/redeem":          true,
+}
+
+func (s *Server) AuthMiddleware() fiber.Handler {
 	return jwtware.New(jwtware.Config{
 		Filter: func(c *fiber.Ctx) bool {
-			path := c.Path()
-			return path == "/api/login" || path == "/api/health" || path == "/api/cap/challenge" || path == "/api/cap/redeem"
+			return publicPaths[s.routePath(c)]
 		},
-		SigningKey:  jwtware.SigningKey{Key: []byte(vars.Password)},
-		TokenLookup: "header:Authorization,query:token,cookie:droptoken",
+		SigningKey:     jwtware.SigningKey{Key: s.jwtSecret},
+		TokenLookup:    "header:Authorization,query:token,cookie:droptoken",
+		SuccessHandler: s.checkTokenDevice,
 	})
 }
 
-func CreateChallenge(c *fiber.Ctx) error {
-	challenge := vars.CapInstance.CreateChallenge(nil)
+// checkTokenDevice refuses the tokens of deleted devices, which would otherwise
+// keep their device's deliveries, channel access and peer ID until they expire.
+func (s *Server) checkTokenDevice(c *fiber.Ctx) error {
+	deviceID := currentDeviceID(c)
+	if deviceID == "" {
+		return c.Next()
+	}
+	if _, err := s.deviceService.Get(deviceID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "device was deleted",
+			})
+		}
+		return err
+	}
+	return c.Next()
+}
+
+func (s *Server) CreateChallenge(c *fiber.Ctx) error {
+	challenge := s.capInstance.CreateChallenge(nil)
 	return c.JSON(challenge)
 }
 
-func RedeemChallenge(c *fiber.Ctx) error {
+func (s *Server) RedeemChallenge(c *fiber.Ctx) error {
 	var body cap.Solution
 	err := c.BodyParser(&body)
 	if err != nil {
 		return err
 	}
-	resp := vars.CapInstance.RedeemChallenge(&body)
+	resp := s.capInstance.RedeemChallenge(&body)
 	return c.JSON(resp)
 }
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/config"
+	"github.com/zjyl1994/arkdrop/service"
+	"github.com/zjyl1994/arkdrop/utils"
+)
+
+// sessionStorage holds short-lived login state. It has the shape of the CAP
+// storage interface, so CAP challenges can use it too.
+type sessionStorage interface {
+	Get(key string) string
+	Set(key, data string, expire time.Time)
+	Del(key string)
+}
+
+// sharedSessions stores sessions in the database for instances sharing a
+// cluster backend. Keys get prefix, so several users can share the table.
+type sharedSessions struct {
+	service service.AuthSessionService
+	prefix  string
+}
+
+func (s sharedSessions) Get(key string) string {
+	data, err := s.service.Get(s.prefix + key)
+	if err != nil {
+		logrus.Errorln("Load auth session failed:", err)
+	}
+	return data
+}
+
+func (s sharedSessions) Set(key, data string, expire time.Time) {
+	if err := s.service.Set(s.prefix+key, data, expire); err != nil {
+		logrus.Errorln("Save auth session failed:", err)
+	}
+}
+
+func (s sharedSessions) Del(key string) {
+	if err := s.service.Del(s.prefix + key); err != nil {
+		logrus.Errorln("Delete auth session failed:", err)
+	}
+}
+
+// newSessionStorage keeps sessions in memory for a single instance and in
+// the database when other instances may have to read them.
+func (s *Server) newSessionStorage(prefix string, capacity int) sessionStorage {
+	if s.cfg.HubBackend == config.HubBackendMemory {
+		return utils.NewFreeCacheStorage(capacity)
+	}
+	return sharedSessions{service: service.AuthSessionService{Store: s.store}, prefix: prefix}
+}
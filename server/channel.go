@@ -0,0 +1,329 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/zjyl1994/arkdrop/service"
+	"github.com/zjyl1994/arkdrop/utils"
+	"gorm.io/gorm"
+)
+
+// undeclaredPolicyTTL is how long an unused undeclared channel stays cached.
+const undeclaredPolicyTTL = time.Minute
+
+// channelPolicy is the effective configuration of a channel. It is cached so
+// that the message rate limiter survives across connections.
+type channelPolicy struct {
+	name           string
+	declared       bool
+	strict         bool
+	channel        service.Channel
+	maxMessageSize int64
+	rateLimit      int
+	limiter        *rateLimiter
+	// lastUsed is guarded by channelPoliciesMutex.
+	lastUsed time.Time
+}
+
+// channelAccess is what ChannelAccessMiddleware hands to the hub handlers.
+type channelAccess struct {
+	channel string
+	// sender keys the message rate limit, the device ID or else the client IP.
+	sender string
+	// peer addresses the client in signaling messages, ?peer= or else the device ID.
+	peer string
+	user string
+}
+
+type channelItem struct {
+	Name           string   `json:"name"`
+	Declared       bool     `json:"declared"`
+	AllowedDevices []string `json:"allowed_devices"`
+	AllowedUsers   []string `json:"allowed_users"`
+	MaxMessageSize int64    `json:"max_message_size"`
+	RateLimit      int      `json:"rate_limit"`
+	Members        int      `json:"members"`
+}
+
+func (s *Server) loadChannelPolicy(name string) (*channelPolicy, error) {
+	s.channelPoliciesMutex.Lock()
+	defer s.channelPoliciesMutex.Unlock()
+
+	now := time.Now()
+	if policy, ok := s.channelPolicies[name]; ok {
+		policy.lastUsed = now
+		return policy, nil
+	}
+	s.pruneChannelPoliciesLocked(now)
+
+	declared := true
+	channel, err := s.channelService.Get(name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		declared = false
+		channel = service.Channel{Name: name}
+	} else if err != nil {
+		return nil, err
+	}
+
+	policy := &channelPolicy{
+		name:           name,
+		declared:       declared,
+		strict:         s.cfg.ChannelStrict,
+		channel:        channel,
+		maxMessageSize: utils.COALESCE(channel.MaxMessageSize, s.cfg.ChannelMaxMessage),
+		rateLimit:      utils.COALESCE(channel.RateLimit, s.cfg.ChannelRateLimit),
+	}
+	policy.limiter = newRateLimiter(policy.rateLimit, 0, time.Minute)
+	policy.lastUsed = now
+	s.channelPolicies[name] = policy
+	return policy, nil
+}
+
+// pruneChannelPoliciesLocked drops undeclared channels unused for longer than
+// undeclaredPolicyTTL, so clients can't grow the cache by naming new channels.
+// Their rate limit windows have passed by then. Callers must hold channelPoliciesMutex.
+func (s *Server) pruneChannelPoliciesLocked(now time.Time) {
+	if now.Sub(s.channelPoliciesPruned) < undeclaredPolicyTTL {
+		return
+	}
+	s.channelPoliciesPruned = now
+	for name, policy := range s.channelPolicies {
+		if !policy.declared && now.Sub(policy.lastUsed) > undeclaredPolicyTTL {
+			delete(s.channelPolicies, name)
+		}
+	}
+}
+
+func (s *Server) forgetChannelPolicy(name string) {
+	s.channelPoliciesMutex.Lock()
+	defer s.channelPoliciesMutex.Unlock()
+
+	delete(s.channelPolicies, name)
+}
+
+// allows reports whether a client of deviceID and user may join. Undeclared channels
+// are open unless ARKDROP_CHANNEL_STRICT is set, in which case only the default channel is.
+func (p *channelPolicy) allows(deviceID, user string) bool {
+	if !p.declared {
+		return !p.strict || p.name == defaultChannel
+	}
+	return p.channel.Allows(deviceID, user)
+}
+
+func (p *channelPolicy) tooLarge(size int) bool {
+	return p.maxMessageSize > 0 && int64(size) > p.maxMessageSize
+}
+
+// ChannelAccessMiddleware resolves ?channel= and rejects clients the channel does not admit,
+// before a websocket upgrade or event stream starts.
+func (s *Server) ChannelAccessMiddleware(c *fiber.Ctx) error {
+	// Query values point into the request buffer, which fasthttp reuses while
+	// the policy cache and the subscription keep the names.
+	name := strings.Clone(c.Query("channel"))
+	if name == "" {
+		name = defaultChannel
+	}
+	if !service.ValidChannelName(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "invalid channel name",
+		})
+	}
+	policy, err := s.loadChannelPolicy(name)
+	if err != nil {
+		return err
+	}
+	peer := strings.Clone(c.Query("peer"))
+	if peer != "" && !service.ValidChannelName(peer) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "invalid peer id",
+		})
+	}
+	deviceID, user := currentDeviceID(c), currentUser(c)
+	if !policy.allows(deviceID, user) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "channel access denied",
+		})
+	}
+	// Signals are addressed by peer ID, so a client must not take a device's.
+	// Device tokens are bound to their device, others may not name any device.
+	if peer != "" && peer != deviceID {
+		if deviceID != "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "peer id must be the device id of the token",
+			})
+		}
+		_, err := s.deviceService.Get(peer)
+		if err == nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "peer id belongs to a device",
+			})
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	c.Locals("channel", &channelAccess{
+		channel: name,
+		sender:  utils.COALESCE(deviceID, s.clientIP(c)),
+		peer:    utils.COALESCE(peer, deviceID),
+		user:    user,
+	})
+	return c.Next()
+}
+
+func (s *Server) ListChannels(c *fiber.Ctx) error {
+	channels, err := s.channelService.List()
+	if err != nil {
+		return err
+	}
+	members := s.roomMembers()
+
+	list := make([]channelItem, 0, len(channels)+len(members))
+	seen := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		seen[channel.Name] = true
+		list = append(list, channelItem{
+			Name:           channel.Name,
+			Declared:       true,
+			AllowedDevices: append([]string{}, channel.Devices()...),
+			AllowedUsers:   append([]string{}, channel.Users()...),
+			MaxMessageSize: utils.COALESCE(channel.MaxMessageSize, s.cfg.ChannelMaxMessage),
+			RateLimit:      utils.COALESCE(channel.RateLimit, s.cfg.ChannelRateLimit),
+			Members:        members[channel.Name],
+		})
+	}
+	for name, count := range members {
+		if seen[name] {
+			continue
+		}
+		list = append(list, channelItem{
+			Name:           name,
+			AllowedDevices: []string{},
+			AllowedUsers:   []string{},
+			MaxMessageSize: s.cfg.ChannelMaxMessage,
+			RateLimit:      s.cfg.ChannelRateLimit,
+			Members:        count,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"list": list,
+	})
+}
+
+func parseChannelLimit(c *fiber.Ctx, key string) (int64, error) {
+	raw := c.FormValue(key)
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || value < 0 {
+		return 0, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "invalid " + key,
+		})
+	}
+	return value, nil
+}
+
+// ChannelAdminMiddleware keeps device tokens away from channel declarations,
+// so a device can't put itself on an access list. Login sessions manage them.
+func (s *Server) ChannelAdminMiddleware(c *fiber.Ctx) error {
+	if currentDeviceID(c) != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "device tokens can't manage channels",
+		})
+	}
+	return c.Next()
+}
+
+// SaveChannel declares a channel or replaces its access lists and limits.
+// Members that are no longer allowed are disconnected.
+func (s *Server) SaveChannel(c *fiber.Ctx) error {
+	name := c.FormValue("name")
+	if !service.ValidChannelName(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "invalid channel name",
+		})
+	}
+	maxMessageSize, err := parseChannelLimit(c, "max_message_size")
+	if err != nil {
+		return err
+	}
+	rateLimit, err := parseChannelLimit(c, "rate_limit")
+	if err != nil {
+		return err
+	}
+	devices := utils.SplitList(c.FormValue("allowed_devices"))
+	for _, deviceID := range devices {
+		if _, err := s.deviceService.Get(deviceID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"message": "unknown device " + deviceID,
+				})
+			}
+			return err
+		}
+	}
+
+	users := utils.SplitList(c.FormValue("allowed_users"))
+
+	channel, err := s.channelService.Save(name, devices, users, maxMessageSize, int(rateLimit))
+	if err != nil {
+		return err
+	}
+	s.recordAudit(c, service.AuditChannelSave, 0, map[string]any{
+		"channel":          name,
+		"allowed_devices":  devices,
+		"allowed_users":    users,
+		"max_message_size": maxMessageSize,
+		"rate_limit":       rateLimit,
+	})
+	if err := s.reloadChannelPolicy(name); err != nil {
+		return err
+	}
+	return c.JSON(channel)
+}
+
+func (s *Server) DeleteChannel(c *fiber.Ctx) error {
+	name := c.Query("name")
+	if err := s.channelService.Delete(name); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "channel not found",
+			})
+		}
+		return err
+	}
+	s.recordAudit(c, service.AuditChannelDelete, 0, map[string]any{"channel": name})
+	if err := s.reloadChannelPolicy(name); err != nil {
+		return err
+	}
+	return c.SendString("OK")
+}
+
+// reloadChannelPolicy applies a changed channel declaration here and on the other instances.
+func (s *Server) reloadChannelPolicy(name string) error {
+	if err := s.applyChannelPolicy(name); err != nil {
+		return err
+	}
+	s.publishHubMessage(hubMessage{Kind: hubMessagePolicy, Channel: name})
+	return nil
+}
+
+// applyChannelPolicy reloads the declaration of channel name and disconnects
+// the subscribers it no longer allows.
+func (s *Server) applyChannelPolicy(name string) error {
+	s.forgetChannelPolicy(name)
+	policy, err := s.loadChannelPolicy(name)
+	if err != nil {
+		return err
+	}
+	s.evictSubscribers(name, func(sub subscriber) bool {
+		return !policy.allows(sub.device(), sub.user())
+	}, websocket.ClosePolicyViolation, "channel access revoked")
+	return nil
+}
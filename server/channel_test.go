@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/zjyl1994/arkdrop/config"
+)
+
+func TestChannelAccess(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := s.testToken(t, "", adminUser)
+	allowedID, allowed := s.registerTestDevice(t, "allowed")
+	_, denied := s.registerTestDevice(t, "denied")
+	laptopID, _ := s.registerTestDevice(t, "laptop")
+
+	resp := s.request(t, http.MethodPost, "/api/channel/save", admin, url.Values{
+		"name":            {"team"},
+		"allowed_devices": {allowedID},
+		"allowed_users":   {"alice@example.com"},
+	})
+	expectStatus(t, resp, http.StatusOK)
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"listed device", allowed, http.StatusOK},
+		{"other device", denied, http.StatusForbidden},
+		{"listed user", s.testToken(t, "", "alice@example.com"), http.StatusOK},
+		{"listed user on another device", s.testToken(t, laptopID, "alice@example.com"), http.StatusOK},
+		{"other user", s.testToken(t, "", "bob@example.com"), http.StatusForbidden},
+		{"admin", admin, http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// The middleware answers before the websocket upgrade, so a
+			// plain GET shows whether the client would be let in.
+			resp := s.request(t, http.MethodGet, "/api/channel/peers?channel=team", tc.token, nil)
+			expectStatus(t, resp, tc.want)
+			if tc.want == http.StatusForbidden {
+				expectStatus(t, s.request(t, http.MethodGet, "/api/ws?channel=team", tc.token, nil), http.StatusForbidden)
+				expectStatus(t, s.request(t, http.MethodGet, "/api/events?channel=team", tc.token, nil), http.StatusForbidden)
+			}
+		})
+	}
+
+	t.Run("devices can't change the access list", func(t *testing.T) {
+		for _, token := range []string{denied, allowed} {
+			resp := s.request(t, http.MethodPost, "/api/channel/save", token, url.Values{
+				"name":            {"team"},
+				"allowed_devices": {""},
+			})
+			expectStatus(t, resp, http.StatusForbidden)
+			expectStatus(t, s.request(t, http.MethodPost, "/api/channel/delete?name=team", token, nil), http.StatusForbidden)
+		}
+		expectStatus(t, s.request(t, http.MethodGet, "/api/ws?channel=team", denied, nil), http.StatusForbidden)
+	})
+
+	t.Run("undeclared channels", func(t *testing.T) {
+		expectStatus(t, s.request(t, http.MethodGet, "/api/channel/peers?channel=open", denied, nil), http.StatusOK)
+		expectStatus(t, s.request(t, http.MethodPost, "/api/channel/delete?name=team", admin, nil), http.StatusOK)
+		expectStatus(t, s.request(t, http.MethodGet, "/api/channel/peers?channel=team", denied, nil), http.StatusOK)
+	})
+}
+
+func TestChannelStrict(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.ChannelStrict = true })
+	admin := s.testToken(t, "", adminUser)
+
+	expectStatus(t, s.request(t, http.MethodGet, "/api/channel/peers", admin, nil), http.StatusOK)
+	expectStatus(t, s.request(t, http.MethodGet, "/api/channel/peers?channel=other", admin, nil), http.StatusForbidden)
+	expectStatus(t, s.request(t, http.MethodPost, "/api/channel/save", admin, url.Values{"name": {"other"}}), http.StatusOK)
+	expectStatus(t, s.request(t, http.MethodGet, "/api/channel/peers?channel=other", admin, nil), http.StatusOK)
+}
+
+func TestChannelPeerBinding(t *testing.T) {
+	s := newTestServer(t, nil)
+	deviceID, device := s.registerTestDevice(t, "phone")
+	admin := s.testToken(t, "", adminUser)
+
+	expectStatus(t, s.request(t, http.MethodGet, "/api/channel/peers?peer="+deviceID, device, nil), http.StatusOK)
+	expectStatus(t, s.request(t, http.MethodGet, "/api/channel/peers?peer=someone-else", device, nil), http.StatusForbidden)
+	expectStatus(t, s.request(t, http.MethodGet, "/api/channel/peers?peer="+deviceID, admin, nil), http.StatusForbidden)
+	expectStatus(t, s.request(t, http.MethodGet, "/api/channel/peers?peer=browser-tab", admin, nil), http.StatusOK)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// parseTrustedProxies turns the trusted_proxies entries, addresses or CIDR
+// ranges, into networks.
+func parseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		bits := 8 * net.IPv4len
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets, nil
+}
+
+func (s *Server) trustedProxy(ip net.IP) bool {
+	for _, ipNet := range s.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the address rate limits, lockouts and the audit log key on.
+// Each proxy appends the peer it saw to X-Forwarded-For, so the rightmost
+// entry that is not a trusted proxy is the client; entries left of it are
+// whatever the client chose to send. Peers on a unix socket are trusted as
+// proxies, since only local processes with access to the socket reach it and
+// they would otherwise all share one address.
+func (s *Server) clientIP(c *fiber.Ctx) string {
+	remote := c.Context().RemoteIP()
+	if !s.trustedProxy(remote) && !fromUnixSocket(c.Context().Conn()) {
+		return remote.String()
+	}
+	entries := strings.Split(c.Get(fiber.HeaderXForwardedFor), ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(entries[i]))
+		if ip == nil {
+			break
+		}
+		if !s.trustedProxy(ip) {
+			return ip.String()
+		}
+	}
+	return remote.String()
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/hub"
+	"github.com/zjyl1994/arkdrop/service"
+	"gorm.io/gorm"
+)
+
+// relayMessage broadcasts a message from a hub client. Clipboard messages are
+// stamped with their source device, kept as the latest entry of the channel
+// and, with ARKDROP_CLIPBOARD_PARCELS, saved as a parcel too.
+func (s *Server) relayMessage(channel string, msgType int, message []byte, sender subscriber, sourceDeviceID string) (int64, error) {
+	if msgType != websocket.TextMessage {
+		return s.broadcastToRoom(channel, msgType, message, sender, sourceDeviceID), nil
+	}
+	clip, ok, err := hub.ParseClipboardMessage(message)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return s.broadcastToRoom(channel, msgType, message, sender, sourceDeviceID), nil
+	}
+
+	if sender != nil {
+		sourceDeviceID = sender.device()
+	}
+	clip.SourceDevice = sourceDeviceID
+	clip.CreatedAt = time.Now().Unix()
+	message, err = json.Marshal(clip)
+	if err != nil {
+		return 0, err
+	}
+
+	seq := s.broadcastToRoom(channel, msgType, message, sender, sourceDeviceID)
+	if err := s.clipboardService.Save(channel, seq, message); err != nil {
+		logrus.Errorln("Save clipboard entry failed: ", err)
+	}
+	if s.cfg.ClipboardParcels {
+		s.saveClipboardParcel(channel, clip)
+	}
+	return seq, nil
+}
+
+func (s *Server) saveClipboardParcel(channel string, clip hub.ClipboardMessage) {
+	parcel, err := s.clipboardService.SaveAsParcel(clip)
+	if err != nil {
+		logrus.Errorln("Save clipboard parcel failed: ", err)
+		return
+	}
+	err = s.auditService.Record(service.AuditEvent{
+		Type:     service.AuditParcelCreate,
+		TargetID: parcel.ID,
+		DeviceID: clip.SourceDevice,
+	}, map[string]any{
+		"source":  "clipboard",
+		"channel": channel,
+		"kind":    clip.Kind,
+	})
+	if err != nil {
+		logrus.Errorln("Record audit event failed:", err)
+	}
+	s.broadcastToRoom(defaultChannel, websocket.TextMessage, []byte("list_change"), nil, clip.SourceDevice)
+}
+
+// latestClipboardEvent returns the last clipboard message of channel as a hub event for a joining subscriber.
+func (s *Server) latestClipboardEvent(channel string) (service.HubEvent, bool) {
+	entry, err := s.clipboardService.Latest(channel)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logrus.Errorln("Load clipboard entry failed: ", err)
+		}
+		return service.HubEvent{}, false
+	}
+	var clip hub.ClipboardMessage
+	_ = json.Unmarshal([]byte(entry.Message), &clip)
+	return service.HubEvent{
+		Seq:            entry.Seq,
+		Channel:        entry.Channel,
+		SourceDeviceID: clip.SourceDevice,
+		MsgType:        websocket.TextMessage,
+		Payload:        []byte(entry.Message),
+	}, true
+}
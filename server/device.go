@@ -0,0 +1,160 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zjyl1994/arkdrop/service"
+	"github.com/zjyl1994/arkdrop/vars"
+	"gorm.io/gorm"
+)
+
+type devicePresenceItem struct {
+	service.Device
+	Online      bool `json:"online"`
+	Connections int  `json:"connections"`
+}
+
+// currentTokenExpiry keeps a re-issued token on the lifetime of the one presented.
+func currentTokenExpiry(c *fiber.Ctx) time.Time {
+	if token, ok := c.Locals("user").(*jwt.Token); ok {
+		if exp, err := token.Claims.GetExpirationTime(); err == nil && exp != nil {
+			return exp.Time
+		}
+	}
+	return time.Now().Add(vars.JWT_TOKEN_EXPIRE)
+}
+
+func deviceNotFound(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		"message": "device not found",
+	})
+}
+
+// RegisterDevice names the calling device and re-issues its token with the
+// device claim. A token only ever gets its own device ID back, since the ID is
+// what device-targeted parcels and channel ACLs trust.
+func (s *Server) RegisterDevice(c *fiber.Ctx) error {
+	name := c.FormValue("name")
+	var (
+		device service.Device
+		err    error
+	)
+	if id := c.FormValue("id"); id != "" {
+		if id != currentDeviceID(c) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "token is not bound to this device",
+			})
+		}
+		device, err = s.deviceService.Get(id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return deviceNotFound(c)
+			}
+			return err
+		}
+		if name != "" {
+			if err := s.deviceService.Rename(device.ID, name); err != nil {
+				return err
+			}
+			device.Name = name
+		}
+	} else {
+		if name == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "missing device name",
+			})
+		}
+		device, err = s.deviceService.Register(name)
+		if err != nil {
+			return err
+		}
+		s.recordAudit(c, service.AuditDeviceRegister, 0, map[string]any{
+			"device_id": device.ID,
+			"name":      device.Name,
+		})
+	}
+
+	tokenString, err := s.signToken(c, currentTokenExpiry(c), device.ID, currentUser(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{
+		"device": device,
+		"token":  tokenString,
+	})
+}
+
+func (s *Server) ListDevices(c *fiber.Ctx) error {
+	devices, err := s.deviceService.List()
+	if err != nil {
+		return err
+	}
+	online := s.onlineDevices()
+	list := make([]devicePresenceItem, 0, len(devices))
+	for _, device := range devices {
+		list = append(list, devicePresenceItem{
+			Device:      device,
+			Online:      online[device.ID] > 0,
+			Connections: online[device.ID],
+		})
+	}
+	return c.JSON(fiber.Map{
+		"current": currentDeviceID(c),
+		"list":    list,
+	})
+}
+
+func (s *Server) DevicePresence(c *fiber.Ctx) error {
+	devices, err := s.deviceService.List()
+	if err != nil {
+		return err
+	}
+	online := s.onlineDevices()
+	list := make([]devicePresenceItem, 0, len(online))
+	for _, device := range devices {
+		if online[device.ID] == 0 {
+			continue
+		}
+		list = append(list, devicePresenceItem{
+			Device:      device,
+			Online:      true,
+			Connections: online[device.ID],
+		})
+	}
+	return c.JSON(fiber.Map{
+		"list": list,
+	})
+}
+
+func (s *Server) RenameDevice(c *fiber.Ctx) error {
+	name := c.FormValue("name")
+	if name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "missing device name",
+		})
+	}
+	if err := s.deviceService.Rename(c.Query("id"), name); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return deviceNotFound(c)
+		}
+		return err
+	}
+	return c.SendString("OK")
+}
+
+func (s *Server) DeleteDevice(c *fiber.Ctx) error {
+	id := c.Query("id")
+	if err := s.deviceService.Delete(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return deviceNotFound(c)
+		}
+		return err
+	}
+	s.recordAudit(c, service.AuditDeviceDelete, 0, map[string]any{"device_id": id})
+	s.evictDevice(id)
+	s.publishHubMessage(hubMessage{Kind: hubMessageDevice, Device: id})
+	return c.SendString("OK")
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/fasthttp/websocket"
+)
+
+func TestDeletedDeviceToken(t *testing.T) {
+	s := newTestServer(t, nil)
+	addr := s.serve(t)
+	admin := s.testToken(t, "", adminUser)
+	deviceID, device := s.registerTestDevice(t, "phone")
+
+	expectStatus(t, s.request(t, http.MethodGet, "/api/list", device, nil), http.StatusOK)
+	conn := dial(t, addr, "channel=default", device)
+	waitFor(t, func() bool { return s.onlineDevices()[deviceID] > 0 })
+
+	expectStatus(t, s.request(t, http.MethodPost, "/api/device/delete?id="+url.QueryEscape(deviceID), admin, nil), http.StatusOK)
+
+	// The open connection is dropped, and the token no longer authenticates.
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+			t.Fatalf("read after delete = %v, want a policy violation close", err)
+		}
+		break
+	}
+	expectStatus(t, s.request(t, http.MethodGet, "/api/list", device, nil), http.StatusUnauthorized)
+	expectStatus(t, s.request(t, http.MethodGet, "/api/channel/peers?peer="+deviceID, device, nil), http.StatusUnauthorized)
+	expectStatus(t, s.request(t, http.MethodPost, "/api/device/delete?id="+url.QueryEscape(deviceID), admin, nil), http.StatusNotFound)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/discovery"
+	"github.com/zjyl1994/arkdrop/vars"
+)
+
+// startDiscovery announces the first TCP listener reachable from the LAN over
+// mDNS so clients can find it without knowing its address. Failures only cost
+// discoverability.
+func (s *Server) startDiscovery(listeners []net.Listener) {
+	if !s.cfg.MDNS {
+		return
+	}
+	port := 0
+	for _, ln := range listeners {
+		if addr, ok := ln.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+			port = addr.Port
+			break
+		}
+	}
+	if port == 0 {
+		logrus.Debugln("Skip mDNS advertisement, no listener is reachable from the LAN.")
+		return
+	}
+
+	var err error
+	s.advertiser, err = discovery.Advertise(discovery.Info{
+		Instance: s.cfg.MDNSName,
+		Port:     port,
+		Version:  vars.Version,
+		TLS:      s.cfg.TLSMode != vars.TLS_MODE_OFF,
+		BasePath: s.cfg.BasePath,
+	})
+	if err != nil {
+		logrus.Warnln("mDNS advertisement failed:", err)
+		return
+	}
+	logrus.Infoln("Advertising", discovery.ServiceType, "on port", port)
+}
+
+func (s *Server) stopDiscovery() {
+	if s.advertiser == nil {
+		return
+	}
+	if err := s.advertiser.Shutdown(); err != nil {
+		logrus.Warnln("Stop mDNS advertisement failed:", err)
+	}
+	s.advertiser = nil
+}
@@ -0,0 +1,339 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/service"
+)
+
+const (
+	maxReplayEvents = 1000
+	defaultChannel  = "default"
+)
+
+// subscriber is a live hub connection, whatever transport carries it.
+// The hub calls deliver, replayTruncated and close with roomsMutex held, so
+// they only queue work for the connection's own writer and never block.
+type subscriber interface {
+	room() string
+	device() string
+	user() string
+	peer() string
+	deliver(setting ClientSetting, event service.HubEvent) error
+	// replayTruncated tells a resuming client that the replay stopped at seq
+	// after maxReplayEvents events, with more left.
+	replayTruncated(seq int64) error
+	close(code int, reason string)
+}
+
+type ClientSetting struct {
+	Echo bool
+	// Resume marks every delivered message with its sequence number.
+	Resume bool
+}
+
+var errHubClosed = errors.New("server is shutting down")
+
+func (s *Server) touchDevice(deviceID string) {
+	if deviceID == "" {
+		return
+	}
+	if err := s.deviceService.Touch(deviceID); err != nil {
+		logrus.Warnln("Update device last seen failed:", err)
+	}
+}
+
+// joinRoom registers sub and, for resuming subscribers, replays the events
+// after since. Other subscribers receive the latest clipboard entry instead.
+// Both happen under eventsMutex so no live message can slip between the
+// replayed backlog and the live stream.
+func (s *Server) joinRoom(sub subscriber, setting ClientSetting, since int64) error {
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+
+	var backlog []service.HubEvent
+	if setting.Resume {
+		events, err := s.hubEventService.Since(since, sub.room(), sub.device(), maxReplayEvents)
+		if err != nil {
+			return err
+		}
+		backlog = events
+	} else if event, ok := s.latestClipboardEvent(sub.room()); ok {
+		// Newcomers start from the current clipboard; resuming ones get it through the replay.
+		if setting.Echo || sub.device() == "" || event.SourceDeviceID != sub.device() {
+			backlog = []service.HubEvent{event}
+		}
+	}
+
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	if s.hubClosed {
+		sub.close(websocket.CloseGoingAway, errHubClosed.Error())
+		return errHubClosed
+	}
+	for _, event := range backlog {
+		if setting.Resume {
+			s.replayedUpTo[sub] = event.Seq
+			if !setting.Echo && sub.device() != "" && event.SourceDeviceID == sub.device() {
+				continue
+			}
+		}
+		if err := sub.deliver(setting, event); err != nil {
+			delete(s.replayedUpTo, sub)
+			return err
+		}
+	}
+	if setting.Resume && len(backlog) == maxReplayEvents {
+		if err := sub.replayTruncated(backlog[len(backlog)-1].Seq); err != nil {
+			delete(s.replayedUpTo, sub)
+			return err
+		}
+	}
+
+	s.addSubscriberLocked(sub, setting)
+	return nil
+}
+
+func (s *Server) addSubscriberLocked(sub subscriber, setting ClientSetting) {
+	if _, exists := s.rooms[sub.room()]; !exists {
+		s.rooms[sub.room()] = make(map[subscriber]bool)
+	}
+	s.rooms[sub.room()][sub] = true
+	s.clientSettings[sub] = setting
+	if sub.device() != "" {
+		s.devicePresence[sub.device()]++
+	}
+	s.presenceChangedLocked()
+}
+
+func (s *Server) leaveRoom(sub subscriber) {
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	s.detachSubscriberLocked(sub)
+}
+
+// detachSubscriberLocked drops every trace of sub from the hub. Callers must hold roomsMutex.
+func (s *Server) detachSubscriberLocked(sub subscriber) {
+	subs, exists := s.rooms[sub.room()]
+	if !exists {
+		return
+	}
+	if _, found := subs[sub]; !found {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(s.rooms, sub.room())
+	}
+	delete(s.clientSettings, sub)
+	delete(s.replayedUpTo, sub)
+	if sub.device() != "" {
+		s.devicePresence[sub.device()]--
+		if s.devicePresence[sub.device()] <= 0 {
+			delete(s.devicePresence, sub.device())
+		}
+	}
+	s.presenceChangedLocked()
+}
+
+// persistEventLocked stores a relayed message so offline clients can replay it later.
+// Callers must hold eventsMutex to keep sequence order equal to delivery order.
+func (s *Server) persistEventLocked(event *service.HubEvent) {
+	if err := s.hubEventService.Append(event); err != nil {
+		logrus.Errorln("Persist hub event failed: ", err)
+	}
+}
+
+func (s *Server) deliverLocked(sub subscriber, event service.HubEvent) {
+	err := sub.deliver(s.clientSettings[sub], event)
+	if errors.Is(err, errSlowSubscriber) {
+		logrus.Warnln("Hub subscriber fell behind, disconnecting it: ", sub.room())
+		sub.close(websocket.CloseTryAgainLater, err.Error())
+		s.detachSubscriberLocked(sub)
+	} else if err != nil {
+		logrus.Errorln("Hub send message failed: ", err)
+		sub.close(websocket.CloseInternalServerErr, "")
+		s.detachSubscriberLocked(sub)
+	}
+}
+
+// broadcastToRoom relays a message to every subscriber of channel, on this
+// instance and the others. sender is nil for messages that did not arrive over
+// a live connection; sourceDeviceID then identifies the publisher. It returns
+// the sequence number of the event.
+func (s *Server) broadcastToRoom(channel string, msgType int, message []byte, sender subscriber, sourceDeviceID string) int64 {
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+
+	event := service.HubEvent{
+		Channel:        channel,
+		SourceDeviceID: sourceDeviceID,
+		MsgType:        msgType,
+		Payload:        message,
+	}
+	if sender != nil {
+		event.SourceDeviceID = sender.device()
+	}
+	s.persistEventLocked(&event)
+
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+	s.deliverEventLocked(event, sender)
+	s.publishEvent(event)
+	return event.Seq
+}
+
+// sendToDevice delivers a message to every connection of deviceID, whatever room it joined.
+func (s *Server) sendToDevice(deviceID string, msgType int, message []byte) {
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+
+	event := service.HubEvent{
+		TargetDeviceID: deviceID,
+		MsgType:        msgType,
+		Payload:        message,
+	}
+	s.persistEventLocked(&event)
+
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+	s.deliverEventLocked(event, nil)
+	s.publishEvent(event)
+}
+
+// deliverEventLocked hands event to the local subscribers it is meant for:
+// those of the target device, or else those of the channel. The sender only
+// gets its own message back when it asked for echo, and nobody gets an event
+// twice because it was already in their replay.
+func (s *Server) deliverEventLocked(event service.HubEvent, sender subscriber) {
+	if event.TargetDeviceID != "" {
+		for _, subs := range s.rooms {
+			for sub := range subs {
+				if sub.device() != event.TargetDeviceID || event.Seq != 0 && event.Seq <= s.replayedUpTo[sub] {
+					continue
+				}
+				s.deliverLocked(sub, event)
+			}
+		}
+		return
+	}
+	for sub := range s.rooms[event.Channel] {
+		// skip boardcast to sender when echo disabled.
+		if !s.clientSettings[sub].Echo && sub == sender {
+			continue
+		}
+		if event.Seq != 0 && event.Seq <= s.replayedUpTo[sub] {
+			continue
+		}
+		s.deliverLocked(sub, event)
+	}
+}
+
+// broadcastAll notifies every connected subscriber. The message is not stored
+// for replay, so it suits state that clients can fetch again.
+func (s *Server) broadcastAll(msgType int, message []byte) {
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	event := service.HubEvent{
+		MsgType: msgType,
+		Payload: message,
+	}
+	s.deliverAllLocked(event)
+	s.publishHubMessage(hubMessage{Kind: hubMessageAll, Event: &event})
+}
+
+func (s *Server) deliverAllLocked(event service.HubEvent) {
+	for _, subs := range s.rooms {
+		for sub := range subs {
+			s.deliverLocked(sub, event)
+		}
+	}
+}
+
+// evictSubscribers disconnects the subscribers of channel matched by drop.
+func (s *Server) evictSubscribers(channel string, drop func(subscriber) bool, code int, reason string) {
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	for sub := range s.rooms[channel] {
+		if drop(sub) {
+			sub.close(code, reason)
+			s.detachSubscriberLocked(sub)
+		}
+	}
+}
+
+// evictDevice disconnects the subscribers of a deleted device from every channel.
+func (s *Server) evictDevice(deviceID string) {
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	for _, subs := range s.rooms {
+		for sub := range subs {
+			if sub.device() == deviceID {
+				sub.close(websocket.ClosePolicyViolation, "device deleted")
+				s.detachSubscriberLocked(sub)
+			}
+		}
+	}
+}
+
+// closeHub disconnects every subscriber with a "going away" close code and refuses new ones.
+func (s *Server) closeHub() {
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	if s.hubClosed {
+		return
+	}
+	s.hubClosed = true
+	for _, subs := range s.rooms {
+		for sub := range subs {
+			sub.close(websocket.CloseGoingAway, errHubClosed.Error())
+			s.detachSubscriberLocked(sub)
+		}
+	}
+	// Let the other instances forget this one's subscribers right away.
+	s.publishHubMessage(hubMessage{Kind: hubMessagePresence, Presence: &presence{}})
+	close(s.hubOutboxStop)
+}
+
+// roomMembers returns the number of subscribers per active channel, across instances.
+func (s *Server) roomMembers() map[string]int {
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	members := make(map[string]int, len(s.rooms))
+	for channel, subs := range s.rooms {
+		members[channel] = len(subs)
+	}
+	for _, remote := range s.remotePresenceLocked() {
+		for channel, count := range remote.Rooms {
+			members[channel] += count
+		}
+	}
+	return members
+}
+
+// onlineDevices returns the number of open connections per device, across instances.
+func (s *Server) onlineDevices() map[string]int {
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	online := make(map[string]int, len(s.devicePresence))
+	for deviceID, count := range s.devicePresence {
+		online[deviceID] = count
+	}
+	for _, remote := range s.remotePresenceLocked() {
+		for deviceID, count := range remote.Devices {
+			online[deviceID] += count
+		}
+	}
+	return online
+}
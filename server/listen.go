@@ -0,0 +1,268 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/config"
+)
+
+// listenFDsStart is the first file descriptor systemd passes, after stdin, stdout and stderr.
+const listenFDsStart = 3
+
+var errNoActivation = errors.New("listen names systemd but no sockets were passed by systemd socket activation")
+
+// openListeners opens every entry of the listen option. Sockets inherited from
+// systemd that no entry asks for are closed.
+func (s *Server) openListeners(network string) (listeners []net.Listener, err error) {
+	defer func() {
+		if err != nil {
+			for _, ln := range listeners {
+				_ = ln.Close()
+			}
+		}
+	}()
+
+	var activated map[string][]net.Listener
+	for _, addr := range s.cfg.Listen {
+		if addr == config.ListenSystemd || strings.HasPrefix(addr, config.ListenSystemd+":") {
+			if activated == nil {
+				if activated, err = activationListeners(); err != nil {
+					return listeners, err
+				}
+			}
+			name, named := strings.CutPrefix(addr, config.ListenSystemd+":")
+			found := false
+			for fdName, fdListeners := range activated {
+				if named && fdName != name {
+					continue
+				}
+				listeners = append(listeners, fdListeners...)
+				delete(activated, fdName)
+				found = true
+			}
+			if !found {
+				return listeners, fmt.Errorf("no socket passed by systemd socket activation for listen entry %q", addr)
+			}
+			continue
+		}
+
+		var ln net.Listener
+		if path, ok := strings.CutPrefix(addr, config.ListenUnixPrefix); ok {
+			ln, err = s.listenUnix(path)
+		} else {
+			ln, err = net.Listen(network, addr)
+		}
+		if err != nil {
+			return listeners, err
+		}
+		listeners = append(listeners, ln)
+	}
+
+	for _, fdListeners := range activated {
+		for _, ln := range fdListeners {
+			logrus.Warnln("Closing socket from systemd that no listen entry uses:", listenerName(ln))
+			_ = ln.Close()
+		}
+	}
+	for i, ln := range listeners {
+		if ln.Addr().Network() == "unix" {
+			listeners[i] = localListener{ln}
+		}
+	}
+	return listeners, nil
+}
+
+// listenUnix creates the socket at path with socket_mode permissions. A socket
+// left behind by a previous run is replaced, one still accepting connections is not.
+func (s *Server) listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("unix socket %s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	mode, _ := strconv.ParseUint(s.cfg.SocketMode, 8, 32)
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// activationListeners takes the sockets systemd passed to this process,
+// grouped by their FileDescriptorName.
+func activationListeners() (map[string][]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errNoActivation
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, errNoActivation
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// Child processes must not take the sockets for their own.
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make(map[string][]net.Listener)
+	for i := 0; i < count; i++ {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		// FileListener duplicates the descriptor, so the original is closed either way.
+		file := os.NewFile(uintptr(listenFDsStart+i), name)
+		ln, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			for _, fdListeners := range listeners {
+				for _, ln := range fdListeners {
+					_ = ln.Close()
+				}
+			}
+			return nil, fmt.Errorf("use socket %d passed by systemd: %w", listenFDsStart+i, err)
+		}
+		listeners[name] = append(listeners[name], ln)
+	}
+	return listeners, nil
+}
+
+// listenerName formats the address of ln the way listen entries are written.
+func listenerName(ln net.Listener) string {
+	if ln.Addr().Network() == "unix" {
+		return config.ListenUnixPrefix + ln.Addr().String()
+	}
+	return ln.Addr().String()
+}
+
+// localListener serves a unix socket. Its peers are on this host, so they get
+// a loopback address, which trusted_proxies can name for a local reverse proxy.
+type localListener struct {
+	net.Listener
+}
+
+func (l localListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return localConn{conn}, nil
+}
+
+type localConn struct {
+	net.Conn
+}
+
+var loopbackAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+// fromUnixSocket reports whether conn was accepted on a unix socket, with or without TLS.
+func fromUnixSocket(conn net.Conn) bool {
+	for {
+		switch c := conn.(type) {
+		case localConn:
+			return true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return false
+		}
+	}
+}
+
+func (localConn) RemoteAddr() net.Addr {
+	return loopbackAddr
+}
+
+// multiListener hands the connections of several listeners to one server.
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	errs      chan error
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newMultiListener(listeners []net.Listener) net.Listener {
+	if len(listeners) == 1 {
+		return listeners[0]
+	}
+	m := &multiListener{
+		listeners: listeners,
+		conns:     make(chan net.Conn),
+		errs:      make(chan error),
+		closed:    make(chan struct{}),
+	}
+	for _, ln := range listeners {
+		go m.accept(ln)
+	}
+	return m
+}
+
+func (m *multiListener) accept(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case m.errs <- err:
+			case <-m.closed:
+				return
+			}
+			// The server retries after timeouts and stops on any other error.
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				continue
+			}
+			return
+		}
+		select {
+		case m.conns <- conn:
+		case <-m.closed:
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-m.conns:
+		return conn, nil
+	case err := <-m.errs:
+		return nil, err
+	case <-m.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (m *multiListener) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		for _, ln := range m.listeners {
+			if closeErr := ln.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
+
+// Addr reports the first listener, servers only use it for logging.
+func (m *multiListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zjyl1994/arkdrop/config"
+)
+
+// unixClient sends every request to the unix socket at path.
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "arkdrop.sock")
+
+	// A socket file left behind by a previous run is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Listen = []string{config.ListenUnixPrefix + path}
+		cfg.SocketMode = "0600"
+		cfg.LoginMaxFailures = 2
+	})
+	listeners, err := s.openListeners("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 1 {
+		t.Fatalf("listeners = %d, want 1", len(listeners))
+	}
+	go func() { _ = s.app.Listener(listeners[0]) }()
+	t.Cleanup(func() { _ = s.app.Shutdown() })
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %o, want 600", info.Mode().Perm())
+	}
+	if _, err := s.listenUnix(path); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("second listen on a live socket = %v, want in use", err)
+	}
+
+	// The proxy in front of the socket passes each client's address, so one
+	// client's failed logins don't lock out the others.
+	client := unixClient(path)
+	redeem := func(forwardedFor string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, "http://arkdrop/api/pair/redeem",
+			strings.NewReader(url.Values{"code": {"000000"}}.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	for range 2 {
+		if status := redeem("203.0.113.1"); status != http.StatusUnauthorized {
+			t.Fatalf("bad code: status %d, want 401", status)
+		}
+	}
+	if status := redeem("203.0.113.1"); status != http.StatusTooManyRequests {
+		t.Errorf("locked out client: status %d, want 429", status)
+	}
+	if status := redeem("203.0.113.2"); status != http.StatusUnauthorized {
+		t.Errorf("other client: status %d, want 401", status)
+	}
+	// A spoofed entry left of the proxy's own doesn't help.
+	if status := redeem("198.51.100.7, 203.0.113.1"); status != http.StatusTooManyRequests {
+		t.Errorf("spoofing client: status %d, want 429", status)
+	}
+}
+
+// TestSystemdActivation runs itself as a child process that inherits a socket
+// the way systemd passes it, since LISTEN_PID must name the receiving process.
+func TestSystemdActivation(t *testing.T) {
+	if listen := os.Getenv("ARKDROP_TEST_ACTIVATION_LISTEN"); listen != "" {
+		systemdActivationChild(t, listen, os.Getenv("ARKDROP_TEST_ACTIVATION_ADDR"))
+		return
+	}
+
+	for _, tc := range []struct {
+		listen string
+		ok     bool
+	}{
+		{config.ListenSystemd, true},
+		{config.ListenSystemd + ":web", true},
+		{config.ListenSystemd + ":other", false},
+	} {
+		t.Run(tc.listen, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			file, err := ln.(*net.TCPListener).File()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			addr := ln.Addr().String()
+			if !tc.ok {
+				addr = ""
+			}
+			cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdActivation$", "-test.v")
+			cmd.Env = append(os.Environ(),
+				"ARKDROP_TEST_ACTIVATION_LISTEN="+tc.listen,
+				"ARKDROP_TEST_ACTIVATION_ADDR="+addr,
+				"LISTEN_FDS=1",
+				"LISTEN_FDNAMES=web",
+			)
+			// The first extra file becomes descriptor 3, where systemd starts.
+			cmd.ExtraFiles = []*os.File{file}
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("child: %v\n%s", err, out)
+			}
+		})
+	}
+}
+
+// systemdActivationChild opens listen and expects the inherited socket on
+// addr, or an error when addr is empty.
+func systemdActivationChild(t *testing.T, listen, addr string) {
+	_ = os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	s := &Server{cfg: &config.Config{Listen: []string{listen}}}
+	listeners, err := s.openListeners("tcp")
+	if os.Getenv("LISTEN_FDS") != "" || os.Getenv("LISTEN_PID") != "" {
+		t.Error("LISTEN_ variables were left for child processes")
+	}
+	if addr == "" {
+		if err == nil {
+			t.Fatal("listen entry naming a socket that wasn't passed was accepted")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listeners[0].Close()
+	if len(listeners) != 1 || listeners[0].Addr().String() != addr {
+		t.Fatalf("listeners = %v, want the one on %s", listeners, addr)
+	}
+}
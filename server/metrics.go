@@ -0,0 +1,139 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	wsClientsDesc = prometheus.NewDesc(
+		"arkdrop_websocket_clients",
+		"Number of connected websocket clients per room.",
+		[]string{"room"}, nil,
+	)
+	sseClientsDesc = prometheus.NewDesc(
+		"arkdrop_sse_clients",
+		"Number of connected event stream clients per room.",
+		[]string{"room"}, nil,
+	)
+	parcelsDesc = prometheus.NewDesc(
+		"arkdrop_parcels",
+		"Number of stored parcels.",
+		[]string{"favorite"}, nil,
+	)
+	attachmentsDesc = prometheus.NewDesc(
+		"arkdrop_attachments",
+		"Number of stored attachments.",
+		nil, nil,
+	)
+	storageBytesDesc = prometheus.NewDesc(
+		"arkdrop_storage_bytes",
+		"Total size in bytes of stored attachments.",
+		nil, nil,
+	)
+)
+
+// arkdropCollector reports the state of one instance when it is scraped.
+type arkdropCollector struct {
+	s *Server
+}
+
+func (arkdropCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- wsClientsDesc
+	ch <- sseClientsDesc
+	ch <- parcelsDesc
+	ch <- attachmentsDesc
+	ch <- storageBytesDesc
+}
+
+func (collector arkdropCollector) Collect(ch chan<- prometheus.Metric) {
+	s := collector.s
+	s.roomsMutex.Lock()
+	for room, subs := range s.rooms {
+		var websockets, streams int
+		for sub := range subs {
+			if _, ok := sub.(*sseSubscriber); ok {
+				streams++
+			} else {
+				websockets++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(wsClientsDesc, prometheus.GaugeValue, float64(websockets), room)
+		ch <- prometheus.MustNewConstMetric(sseClientsDesc, prometheus.GaugeValue, float64(streams), room)
+	}
+	s.roomsMutex.Unlock()
+
+	stats, err := s.parcelService.Stats()
+	if err != nil {
+		logrus.Errorln("Collect parcel stats failed:", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(parcelsDesc, prometheus.GaugeValue, float64(stats.FavoriteParcels), "true")
+	ch <- prometheus.MustNewConstMetric(parcelsDesc, prometheus.GaugeValue, float64(stats.Parcels-stats.FavoriteParcels), "false")
+	ch <- prometheus.MustNewConstMetric(attachmentsDesc, prometheus.GaugeValue, float64(stats.Attachments))
+	ch <- prometheus.MustNewConstMetric(storageBytesDesc, prometheus.GaugeValue, float64(stats.StorageBytes))
+}
+
+func (s *Server) MetricsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		code := c.Response().StatusCode()
+		if err != nil {
+			code = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				code = fiberErr.Code
+			}
+		}
+
+		// Labels stay the same whatever base_path the instance is mounted on.
+		route := strings.TrimPrefix(c.Route().Path, s.cfg.BasePath)
+		if route == "" {
+			route = "/"
+		}
+		method := c.Method()
+		s.metrics.HTTPRequests.WithLabelValues(route, method, strconv.Itoa(code)).Inc()
+		s.metrics.HTTPDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// CountDownloadBytes records the size of successful file responses under the given source label.
+func (s *Server) CountDownloadBytes(source string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if err != nil {
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if status == fiber.StatusOK || status == fiber.StatusPartialContent {
+			if size := c.Response().Header.ContentLength(); size > 0 {
+				s.metrics.DownloadBytes.WithLabelValues(source).Add(float64(size))
+			}
+		}
+		return nil
+	}
+}
+
+func (s *Server) MetricsHandler() fiber.Handler {
+	promHandler := adaptor.HTTPHandler(promhttp.HandlerFor(s.metrics.Registry, promhttp.HandlerOpts{}))
+	return func(c *fiber.Ctx) error {
+		token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.MetricsToken)) == 0 {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		return promHandler(c)
+	}
+}
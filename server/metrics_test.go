@@ -0,0 +1,38 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zjyl1994/arkdrop/config"
+)
+
+func TestMetricsClients(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.MetricsToken = "scrape" })
+	addr := s.serve(t)
+	_, phone := s.registerTestDevice(t, "phone")
+	_, laptop := s.registerTestDevice(t, "laptop")
+
+	dial(t, addr, "channel=default", phone)
+	dial(t, addr, "channel=default", laptop)
+	openStream(t, addr, "channel=default", phone, "")
+	waitFor(t, func() bool { return s.roomMembers()[defaultChannel] == 3 })
+
+	expectStatus(t, s.request(t, http.MethodGet, "/metrics", "", nil), http.StatusUnauthorized)
+	resp := s.request(t, http.MethodGet, "/metrics", "Bearer scrape", nil)
+	expectStatus(t, resp, http.StatusOK)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`arkdrop_websocket_clients{room="default"} 2`,
+		`arkdrop_sse_clients{room="default"} 1`,
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gofiber/fiber/v2"
+	"github.com/zjyl1994/arkdrop/service"
+	"github.com/zjyl1994/arkdrop/utils"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcStateCookie   = "oidc_state"
+	oidcSessionPrefix = "oidc:"
+	oidcSessionExpire = 10 * time.Minute
+)
+
+type oidcSession struct {
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	Remember bool   `json:"remember"`
+}
+
+type oidcClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+func (s *Server) initOIDC() error {
+	if s.cfg.OIDCIssuer == "" {
+		return nil
+	}
+
+	provider, err := oidc.NewProvider(context.Background(), s.cfg.OIDCIssuer)
+	if err != nil {
+		return fmt.Errorf("discover OIDC provider: %w", err)
+	}
+	s.oidcProvider = provider
+	s.oidcVerifier = provider.Verifier(&oidc.Config{ClientID: s.cfg.OIDCClientID})
+	s.oidcOAuth2Config = &oauth2.Config{
+		ClientID:     s.cfg.OIDCClientID,
+		ClientSecret: s.cfg.OIDCClientSecret,
+		RedirectURL:  s.cfg.OIDCRedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}
+	return nil
+}
+
+// oidcAllowed reports whether the verified claims match the configured email or group allow lists.
+func (s *Server) oidcAllowed(claims oidcClaims, groups []string) bool {
+	if claims.Email != "" && claims.EmailVerified {
+		email := strings.ToLower(claims.Email)
+		for _, allowed := range s.cfg.OIDCAllowedEmails {
+			allowed = strings.ToLower(allowed)
+			if email == allowed || (strings.HasPrefix(allowed, "@") && strings.HasSuffix(email, allowed)) {
+				return true
+			}
+		}
+	}
+	for _, group := range groups {
+		if slices.Contains(s.cfg.OIDCAllowedGroups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) extractGroups(idToken *oidc.IDToken) []string {
+	var rawClaims map[string]json.RawMessage
+	if err := idToken.Claims(&rawClaims); err != nil {
+		return nil
+	}
+	raw, ok := rawClaims[s.cfg.OIDCGroupsClaim]
+	if !ok {
+		return nil
+	}
+	var groups []string
+	if err := json.Unmarshal(raw, &groups); err != nil {
+		var group string
+		if json.Unmarshal(raw, &group) == nil && group != "" {
+			return []string{group}
+		}
+		return nil
+	}
+	return groups
+}
+
+func (s *Server) OIDCConfig(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"enabled": s.oidcProvider != nil,
+	})
+}
+
+func (s *Server) OIDCLogin(c *fiber.Ctx) error {
+	if s.oidcProvider == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	state := utils.SecureRandString(32)
+	session := oidcSession{
+		Verifier: oauth2.GenerateVerifier(),
+		Nonce:    utils.SecureRandString(32),
+		Remember: c.Query("remember") == "1" || c.Query("remember") == "true",
+	}
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	s.authSessions.Set(oidcSessionPrefix+state, string(raw), time.Now().Add(oidcSessionExpire))
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     s.cfg.BasePath + "/api/oidc",
+		MaxAge:   int(oidcSessionExpire.Seconds()),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	authURL := s.oidcOAuth2Config.AuthCodeURL(state,
+		oidc.Nonce(session.Nonce),
+		oauth2.S256ChallengeOption(session.Verifier),
+	)
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+func (s *Server) OIDCCallback(c *fiber.Ctx) error {
+	if s.oidcProvider == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	state := c.Query("state")
+	if state == "" || state != c.Cookies(oidcStateCookie) {
+		return c.Status(fiber.StatusBadRequest).SendString("invalid state")
+	}
+	c.ClearCookie(oidcStateCookie)
+
+	rawSession := s.authSessions.Get(oidcSessionPrefix + state)
+	s.authSessions.Del(oidcSessionPrefix + state)
+	var session oidcSession
+	if rawSession == "" || json.Unmarshal([]byte(rawSession), &session) != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("login session expired")
+	}
+
+	if errMsg := c.Query("error"); errMsg != "" {
+		s.recordAudit(c, service.AuditLoginFailure, 0, map[string]any{"reason": "oidc", "error": errMsg})
+		return c.Status(fiber.StatusUnauthorized).SendString(errMsg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	oauth2Token, err := s.oidcOAuth2Config.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(session.Verifier))
+	if err != nil {
+		s.loginGuard.fail(s.clientIP(c))
+		s.recordAudit(c, service.AuditLoginFailure, 0, map[string]any{"reason": "oidc", "error": err.Error()})
+		return c.Status(fiber.StatusUnauthorized).SendString("code exchange failed")
+	}
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).SendString("missing id_token")
+	}
+	idToken, err := s.oidcVerifier.Verify(ctx, rawIDToken)
+	if err != nil || idToken.Nonce != session.Nonce {
+		s.loginGuard.fail(s.clientIP(c))
+		s.recordAudit(c, service.AuditLoginFailure, 0, map[string]any{"reason": "oidc", "error": "invalid id_token"})
+		return c.Status(fiber.StatusUnauthorized).SendString("invalid id_token")
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return err
+	}
+	groups := s.extractGroups(idToken)
+	if !s.oidcAllowed(claims, groups) {
+		s.recordAudit(c, service.AuditLoginFailure, 0, map[string]any{
+			"reason":  "oidc",
+			"subject": idToken.Subject,
+			"email":   claims.Email,
+		})
+		return c.Status(fiber.StatusForbidden).SendString("access denied")
+	}
+
+	user := idToken.Subject
+	if claims.Email != "" && claims.EmailVerified {
+		user = strings.ToLower(claims.Email)
+	}
+	if _, err := s.issueToken(c, session.Remember, user); err != nil {
+		return err
+	}
+	s.loginGuard.succeed(s.clientIP(c))
+	s.recordAudit(c, service.AuditLoginSuccess, 0, map[string]any{
+		"method":  "oidc",
+		"subject": idToken.Subject,
+		"email":   claims.Email,
+	})
+	return c.Redirect(s.cfg.BasePath+"/", fiber.StatusFound)
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zjyl1994/arkdrop/config"
+)
+
+const oidcTestClientID = "arkdrop"
+
+// oidcProvider is an OpenID provider that authorizes whoever it is told to.
+type oidcProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu sync.Mutex
+	// grants maps issued codes to the authorization request they answer.
+	grants map[string]oidcGrant
+}
+
+type oidcGrant struct {
+	email     string
+	nonce     string
+	challenge string
+}
+
+func newOIDCProvider(t *testing.T) *oidcProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &oidcProvider{key: key, grants: make(map[string]oidcGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   encode(key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize answers the authorization request in location, as the provider
+// does once the user signed in, and returns the code it issued.
+func (p *oidcProvider) authorize(t *testing.T, location, email string) string {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request without PKCE: %s", location)
+	}
+	if query.Get("client_id") != oidcTestClientID || query.Get("nonce") == "" {
+		t.Fatalf("authorization request = %s", location)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code := "code-" + query.Get("state")
+	p.grants[code] = oidcGrant{email: email, nonce: query.Get("nonce"), challenge: query.Get("code_challenge")}
+	return code
+}
+
+// setNonce replaces the nonce the ID token of code will carry.
+func (p *oidcProvider) setNonce(code, nonce string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	grant := p.grants[code]
+	grant.nonce = nonce
+	p.grants[code] = grant
+}
+
+func (p *oidcProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	grant, ok := p.grants[r.FormValue("code")]
+	delete(p.grants, r.FormValue("code"))
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.URL,
+		"aud":            oidcTestClientID,
+		"sub":            "user-" + grant.email,
+		"email":          grant.email,
+		"email_verified": true,
+		"nonce":          grant.nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	})
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+// startOIDCLogin begins a login and returns its state and the provider's authorization URL.
+func startOIDCLogin(t *testing.T, s *Server) (string, string) {
+	t.Helper()
+	resp := s.request(t, http.MethodGet, "/api/oidc/login", "", nil)
+	expectStatus(t, resp, http.StatusFound)
+	location := resp.Header.Get("Location")
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("state"), location
+}
+
+// oidcCallback returns from the provider with code, carrying the state cookie stateCookie.
+func oidcCallback(t *testing.T, s *Server, state, stateCookie, code string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+	req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: stateCookie})
+	return s.do(t, req)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newOIDCProvider(t)
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.OIDCIssuer = provider.URL
+		cfg.OIDCClientID = oidcTestClientID
+		cfg.OIDCRedirectURL = "http://example.com/api/oidc/callback"
+		cfg.OIDCAllowedEmails = []string{"@example.com"}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		state, location := startOIDCLogin(t, s)
+		code := provider.authorize(t, location, "Alice@Example.com")
+		resp := oidcCallback(t, s, state, state, code)
+		expectStatus(t, resp, http.StatusFound)
+
+		var session string
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == "droptoken" {
+				session = cookie.Value
+			}
+		}
+		token, err := jwt.Parse(session, func(*jwt.Token) (any, error) { return s.jwtSecret, nil })
+		if err != nil {
+			t.Fatalf("session token: %v", err)
+		}
+		if user := tokenUser(token); user != "alice@example.com" {
+			t.Errorf("user claim = %q, want alice@example.com", user)
+		}
+		expectStatus(t, s.request(t, http.MethodGet, "/api/list", session, nil), http.StatusOK)
+
+		// The state is single use.
+		expectStatus(t, oidcCallback(t, s, state, state, code), http.StatusBadRequest)
+	})
+
+	t.Run("state cookie mismatch", func(t *testing.T) {
+		state, location := startOIDCLogin(t, s)
+		code := provider.authorize(t, location, "alice@example.com")
+		expectStatus(t, oidcCallback(t, s, state, "forged", code), http.StatusBadRequest)
+	})
+
+	t.Run("code of another login", func(t *testing.T) {
+		// The code was issued for the other login's PKCE challenge.
+		state, _ := startOIDCLogin(t, s)
+		_, otherLocation := startOIDCLogin(t, s)
+		code := provider.authorize(t, otherLocation, "alice@example.com")
+		expectStatus(t, oidcCallback(t, s, state, state, code), http.StatusUnauthorized)
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		state, location := startOIDCLogin(t, s)
+		code := provider.authorize(t, location, "alice@example.com")
+		provider.setNonce(code, "replayed")
+		expectStatus(t, oidcCallback(t, s, state, state, code), http.StatusUnauthorized)
+	})
+
+	t.Run("email not allowed", func(t *testing.T) {
+		state, location := startOIDCLogin(t, s)
+		code := provider.authorize(t, location, "mallory@example.org")
+		resp := oidcCallback(t, s, state, state, code)
+		expectStatus(t, resp, http.StatusForbidden)
+		if cookie := resp.Header.Get("Set-Cookie"); strings.Contains(cookie, "droptoken=ey") {
+			t.Error("denied login got a session")
+		}
+	})
+}
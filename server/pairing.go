@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+	"github.com/zjyl1994/arkdrop/service"
+)
+
+const pairingQRCodeSize = 256
+
+func (s *Server) CreatePairingCode(c *fiber.Ctx) error {
+	pairing, err := s.pairingService.Create()
+	if err != nil {
+		return err
+	}
+
+	// Behind a reverse proxy the QR code must lead to the public address and sub-path.
+	baseURL := c.BaseURL() + s.cfg.BasePath
+	if s.cfg.PublicURL != "" {
+		baseURL = s.cfg.PublicURL
+	}
+	pairURL := baseURL + "/pair?token=" + url.QueryEscape(pairing.Token)
+	png, err := qrcode.Encode(pairURL, qrcode.Medium, pairingQRCodeSize)
+	if err != nil {
+		return err
+	}
+
+	s.recordAudit(c, service.AuditPairingCreate, pairing.ID, nil)
+	return c.JSON(fiber.Map{
+		"code":               pairing.Code,
+		"url":                pairURL,
+		"qr_code":            "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		"expires_at":         pairing.ExpiresAt,
+		"expires_in_seconds": pairing.ExpiresAt - time.Now().Unix(),
+	})
+}
+
+func (s *Server) RedeemPairingCode(c *fiber.Ctx) error {
+	pairing, err := s.pairingService.Redeem(c.FormValue("code"), c.FormValue("token"), s.clientIP(c))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPairingCode) {
+			s.loginGuard.fail(s.clientIP(c))
+			s.recordAudit(c, service.AuditLoginFailure, 0, map[string]any{"reason": "pairing"})
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "invalid or expired pairing code",
+			})
+		}
+		return err
+	}
+
+	var deviceID string
+	if deviceName := c.FormValue("device_name"); deviceName != "" {
+		device, err := s.deviceService.Register(deviceName)
+		if err != nil {
+			return err
+		}
+		deviceID = device.ID
+	}
+
+	remember := c.FormValue("remember")
+	// The new session belongs to the device, not to a user.
+	tokenString, err := s.signToken(c, tokenExpiry(remember == "1" || remember == "true"), deviceID, "")
+	if err != nil {
+		return err
+	}
+	s.loginGuard.succeed(s.clientIP(c))
+	s.recordAudit(c, service.AuditLoginSuccess, pairing.ID, map[string]any{"method": "pairing"})
+	return c.SendString(tokenString)
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zjyl1994/arkdrop/config"
+)
+
+func TestPairingURL(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		basePath  string
+		publicURL string
+		want      string
+	}{
+		{name: "root", want: "http://example.com/pair?token="},
+		{name: "base path", basePath: "/drop", want: "http://example.com/drop/pair?token="},
+		{name: "public url", publicURL: "https://files.example.org/drop", want: "https://files.example.org/drop/pair?token="},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *config.Config) {
+				cfg.BasePath = tc.basePath
+				cfg.PublicURL = tc.publicURL
+			})
+			resp := s.request(t, http.MethodPost, s.cfg.BasePath+"/api/pair/create", s.testToken(t, "", adminUser), nil)
+			expectStatus(t, resp, http.StatusOK)
+			var body struct {
+				URL string `json:"url"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(body.URL, tc.want) {
+				t.Errorf("url = %q, want it to start with %q", body.URL, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+	"github.com/zjyl1994/arkdrop/service"
+	"github.com/zjyl1994/arkdrop/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	passkeyRegisterPrefix = "passkey-reg:"
+	passkeyLoginPrefix    = "passkey-login:"
+	passkeySessionExpire  = 5 * time.Minute
+)
+
+func (s *Server) initPasskey() (err error) {
+	if s.cfg.WebAuthnRPID == "" {
+		return nil
+	}
+	s.webAuthn, err = webauthn.New(&webauthn.Config{
+		RPDisplayName: "ArkDrop",
+		RPID:          s.cfg.WebAuthnRPID,
+		RPOrigins:     s.cfg.WebAuthnOrigins,
+	})
+	return err
+}
+
+func (s *Server) savePasskeySession(prefix string, session *webauthn.SessionData) (string, error) {
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	sessionID := utils.SecureRandString(32)
+	s.authSessions.Set(prefix+sessionID, string(raw), time.Now().Add(passkeySessionExpire))
+	return sessionID, nil
+}
+
+func (s *Server) loadPasskeySession(prefix, sessionID string) (webauthn.SessionData, bool) {
+	var session webauthn.SessionData
+	if sessionID == "" {
+		return session, false
+	}
+	raw := s.authSessions.Get(prefix + sessionID)
+	s.authSessions.Del(prefix + sessionID)
+	if raw == "" || json.Unmarshal([]byte(raw), &session) != nil {
+		return session, false
+	}
+	return session, true
+}
+
+func passkeyDisabled(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		"message": "passkey login is not enabled",
+	})
+}
+
+func (s *Server) PasskeyConfig(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"enabled": s.webAuthn != nil,
+	})
+}
+
+// BeginPasskeyRegistration starts adding a passkey. Passkey logins skip the
+// one-time password, so with 2FA enabled code must hold a current one, and
+// only the session handed out here can finish the registration.
+func (s *Server) BeginPasskeyRegistration(c *fiber.Ctx) error {
+	if s.webAuthn == nil {
+		return passkeyDisabled(c)
+	}
+	if ok, err := s.verifyCurrentOTP(c, "code"); !ok {
+		return err
+	}
+
+	user, err := s.passkeyService.User()
+	if err != nil {
+		return err
+	}
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.WebAuthnCredentials()))
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	options, session, err := s.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return err
+	}
+	sessionID, err := s.savePasskeySession(passkeyRegisterPrefix, session)
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{
+		"session": sessionID,
+		"options": options,
+	})
+}
+
+func (s *Server) FinishPasskeyRegistration(c *fiber.Ctx) error {
+	if s.webAuthn == nil {
+		return passkeyDisabled(c)
+	}
+
+	session, ok := s.loadPasskeySession(passkeyRegisterPrefix, c.Query("session"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "registration session expired",
+		})
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(c.Body()))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "invalid credential",
+		})
+	}
+
+	user, err := s.passkeyService.User()
+	if err != nil {
+		return err
+	}
+	credential, err := s.webAuthn.CreateCredential(user, session, parsed)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "credential verification failed",
+		})
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = "Passkey " + time.Now().Format(time.DateOnly)
+	}
+	passkey, err := s.passkeyService.Add(name, credential)
+	if err != nil {
+		return err
+	}
+	s.recordAudit(c, service.AuditPasskeyAdd, passkey.ID, map[string]any{"name": passkey.Name})
+	return c.JSON(passkey)
+}
+
+func (s *Server) BeginPasskeyLogin(c *fiber.Ctx) error {
+	if s.webAuthn == nil {
+		return passkeyDisabled(c)
+	}
+
+	user, err := s.passkeyService.User()
+	if err != nil {
+		return err
+	}
+	if len(user.WebAuthnCredentials()) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "no passkey registered",
+		})
+	}
+
+	options, session, err := s.webAuthn.BeginLogin(user)
+	if err != nil {
+		return err
+	}
+	sessionID, err := s.savePasskeySession(passkeyLoginPrefix, session)
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{
+		"session": sessionID,
+		"options": options,
+	})
+}
+
+func (s *Server) FinishPasskeyLogin(c *fiber.Ctx) error {
+	if s.webAuthn == nil {
+		return passkeyDisabled(c)
+	}
+
+	session, ok := s.loadPasskeySession(passkeyLoginPrefix, c.Query("session"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "login session expired",
+		})
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(c.Body()))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "invalid assertion",
+		})
+	}
+
+	user, err := s.passkeyService.User()
+	if err != nil {
+		return err
+	}
+	credential, err := s.webAuthn.ValidateLogin(user, session, parsed)
+	if err != nil || credential.Authenticator.CloneWarning {
+		s.loginGuard.fail(s.clientIP(c))
+		s.recordAudit(c, service.AuditLoginFailure, 0, map[string]any{"reason": "passkey"})
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	passkey, err := s.passkeyService.Touch(credential)
+	if err != nil {
+		return err
+	}
+
+	remember := c.Query("remember")
+	tokenString, err := s.issueToken(c, remember == "1" || remember == "true", adminUser)
+	if err != nil {
+		return err
+	}
+	s.loginGuard.succeed(s.clientIP(c))
+	s.recordAudit(c, service.AuditLoginSuccess, passkey.ID, map[string]any{
+		"method":  "passkey",
+		"passkey": passkey.Name,
+	})
+	return c.SendString(tokenString)
+}
+
+func (s *Server) ListPasskeys(c *fiber.Ctx) error {
+	passkeys, err := s.passkeyService.List()
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{
+		"list": passkeys,
+	})
+}
+
+func (s *Server) DeletePasskey(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "invalid passkey id",
+		})
+	}
+	if err := s.passkeyService.Delete(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "passkey not found",
+			})
+		}
+		return err
+	}
+	s.recordAudit(c, service.AuditPasskeyDelete, id, nil)
+	return c.SendString("OK")
+}
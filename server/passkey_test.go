@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/zjyl1994/arkdrop/config"
+)
+
+func newPasskeyServer(t *testing.T) *Server {
+	return newTestServer(t, func(cfg *config.Config) {
+		cfg.WebAuthnRPID = "localhost"
+		cfg.WebAuthnOrigins = []string{"http://localhost"}
+	})
+}
+
+// enableTwoFactor turns 2FA on and returns its secret.
+func (s *Server) enableTwoFactor(t *testing.T) string {
+	t.Helper()
+	key, err := s.twoFactorService.BeginEnroll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.twoFactorService.ConfirmEnroll(code); err != nil {
+		t.Fatal(err)
+	}
+	return key.Secret()
+}
+
+func TestPasskeyRegistrationNeedsOTP(t *testing.T) {
+	s := newPasskeyServer(t)
+	admin := s.testToken(t, "", adminUser)
+
+	expectStatus(t, s.request(t, http.MethodPost, "/api/passkey/register/begin", admin, url.Values{}), http.StatusOK)
+
+	secret := s.enableTwoFactor(t)
+	expectStatus(t, s.request(t, http.MethodPost, "/api/passkey/register/begin", admin, url.Values{}), http.StatusBadRequest)
+	expectStatus(t, s.request(t, http.MethodPost, "/api/passkey/register/begin", admin, url.Values{"code": {"000000"}}), http.StatusBadRequest)
+
+	// The step that confirmed the enrollment is spent, the next one is still accepted.
+	code, err := totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, s.request(t, http.MethodPost, "/api/passkey/register/begin", admin, url.Values{"code": {code}}), http.StatusOK)
+	expectStatus(t, s.request(t, http.MethodPost, "/api/passkey/register/begin", admin, url.Values{"code": {code}}), http.StatusBadRequest)
+
+	// Finishing needs the session of a begin that passed the check.
+	expectStatus(t, s.request(t, http.MethodPost, "/api/passkey/register/finish?session=guessed", admin, url.Values{}), http.StatusBadRequest)
+}
+
+func TestDeleteMissingPasskey(t *testing.T) {
+	s := newPasskeyServer(t)
+	admin := s.testToken(t, "", adminUser)
+
+	expectStatus(t, s.request(t, http.MethodPost, "/api/passkey/delete?id=42", admin, nil), http.StatusNotFound)
+	expectStatus(t, s.request(t, http.MethodPost, "/api/passkey/delete?id=x", admin, nil), http.StatusBadRequest)
+}
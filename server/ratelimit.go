@@ -0,0 +1,191 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	globalRateLimitKey = "*"
+	maxLockoutDuration = 24 * time.Hour
+)
+
+type rateWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+// rateLimiter counts requests in fixed windows, both per client IP and across all clients.
+type rateLimiter struct {
+	mu        sync.Mutex
+	perIP     int
+	global    int
+	window    time.Duration
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+func newRateLimiter(perIP, global int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		perIP:   perIP,
+		global:  global,
+		window:  window,
+		windows: make(map[string]*rateWindow),
+	}
+}
+
+// current returns the window of key that now falls into.
+func (l *rateLimiter) current(key string, now time.Time) *rateWindow {
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &rateWindow{resetAt: now.Add(l.window)}
+		l.windows[key] = w
+	}
+	return w
+}
+
+// allow reports how long the caller has to wait before trying again, zero when the request may proceed.
+// Only admitted requests count, so one client over its own limit can't use up
+// the global budget and lock everyone else out.
+func (l *rateLimiter) allow(ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > l.window {
+		for key, w := range l.windows {
+			if !now.Before(w.resetAt) {
+				delete(l.windows, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	perIP := l.current(ip, now)
+	if l.perIP > 0 && perIP.count >= l.perIP {
+		return perIP.resetAt.Sub(now)
+	}
+	global := l.current(globalRateLimitKey, now)
+	if l.global > 0 && global.count >= l.global {
+		return global.resetAt.Sub(now)
+	}
+	perIP.count++
+	global.count++
+	return 0
+}
+
+type failureState struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// failureGuard locks an IP out with exponentially growing durations once it
+// exceeds the allowed number of consecutive failures.
+type failureGuard struct {
+	mu          sync.Mutex
+	maxFailures int
+	lockout     time.Duration
+	states      map[string]*failureState
+	lastSweep   time.Time
+}
+
+func newFailureGuard(maxFailures int, lockout time.Duration) *failureGuard {
+	return &failureGuard{
+		maxFailures: maxFailures,
+		lockout:     lockout,
+		states:      make(map[string]*failureState),
+	}
+}
+
+func (g *failureGuard) lockedFor(ip string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	state, ok := g.states[ip]
+	if !ok {
+		return 0
+	}
+	now := time.Now()
+	if now.Sub(state.lastFailure) > maxLockoutDuration && now.After(state.lockedUntil) {
+		delete(g.states, ip)
+		return 0
+	}
+	if now.Before(state.lockedUntil) {
+		return state.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+func (g *failureGuard) fail(ip string) {
+	if g.maxFailures <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(g.lastSweep) > time.Hour {
+		for key, state := range g.states {
+			if now.Sub(state.lastFailure) > maxLockoutDuration && now.After(state.lockedUntil) {
+				delete(g.states, key)
+			}
+		}
+		g.lastSweep = now
+	}
+
+	state, ok := g.states[ip]
+	if !ok || now.Sub(state.lastFailure) > maxLockoutDuration {
+		state = &failureState{}
+		g.states[ip] = state
+	}
+	state.count++
+	state.lastFailure = now
+
+	if state.count >= g.maxFailures {
+		exponent := float64(state.count - g.maxFailures)
+		lockout := time.Duration(float64(g.lockout) * math.Pow(2, exponent))
+		if lockout <= 0 || lockout > maxLockoutDuration {
+			lockout = maxLockoutDuration
+		}
+		state.lockedUntil = now.Add(lockout)
+	}
+}
+
+func (g *failureGuard) succeed(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.states, ip)
+}
+
+func (s *Server) initRateLimiters() {
+	s.authLimiter = newRateLimiter(s.cfg.RateLimitPerIP, s.cfg.RateLimitGlobal, time.Minute)
+	s.shareLimiter = newRateLimiter(s.cfg.RateLimitPerIP, s.cfg.RateLimitGlobal, time.Minute)
+	s.loginGuard = newFailureGuard(s.cfg.LoginMaxFailures, s.cfg.LoginLockout)
+	s.shareGuard = newFailureGuard(s.cfg.LoginMaxFailures, s.cfg.LoginLockout)
+}
+
+func tooManyRequests(c *fiber.Ctx, wait time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"message": "too many requests",
+	})
+}
+
+func (s *Server) RateLimitMiddleware(limiter *rateLimiter, guard *failureGuard) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ip := s.clientIP(c)
+		if wait := guard.lockedFor(ip); wait > 0 {
+			return tooManyRequests(c, wait)
+		}
+		if wait := limiter.allow(ip); wait > 0 {
+			return tooManyRequests(c, wait)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zjyl1994/arkdrop/config"
+)
+
+// newProxiedServer trusts the test client as a proxy, so each request can
+// name its client in X-Forwarded-For.
+func newProxiedServer(t *testing.T, configure func(cfg *config.Config)) *Server {
+	return newTestServer(t, func(cfg *config.Config) {
+		cfg.TrustedProxies = []string{"0.0.0.0"}
+		configure(cfg)
+	})
+}
+
+// redeemAs tries to redeem a pairing code on behalf of client.
+func (s *Server) redeemAs(t *testing.T, client, code string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/pair/redeem", strings.NewReader(url.Values{"code": {code}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", client)
+	return s.do(t, req)
+}
+
+func expectRetryAfter(t *testing.T, resp *http.Response, min, max time.Duration) {
+	t.Helper()
+	expectStatus(t, resp, http.StatusTooManyRequests)
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil {
+		t.Fatalf("Retry-After = %q", resp.Header.Get("Retry-After"))
+	}
+	if wait := time.Duration(seconds) * time.Second; wait < min || wait > max {
+		t.Errorf("Retry-After = %s, want between %s and %s", wait, min, max)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newProxiedServer(t, func(cfg *config.Config) {
+		cfg.RateLimitPerIP = 3
+		cfg.RateLimitGlobal = 5
+		cfg.LoginMaxFailures = 0
+	})
+
+	for range 3 {
+		expectStatus(t, s.redeemAs(t, "203.0.113.1", "000000"), http.StatusUnauthorized)
+	}
+	expectRetryAfter(t, s.redeemAs(t, "203.0.113.1", "000000"), time.Second, time.Minute)
+
+	// Rejected requests don't use up the global budget.
+	expectStatus(t, s.redeemAs(t, "203.0.113.2", "000000"), http.StatusUnauthorized)
+	expectStatus(t, s.redeemAs(t, "203.0.113.3", "000000"), http.StatusUnauthorized)
+	expectRetryAfter(t, s.redeemAs(t, "203.0.113.4", "000000"), time.Second, time.Minute)
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newProxiedServer(t, func(cfg *config.Config) {
+		cfg.LoginMaxFailures = 2
+		cfg.LoginLockout = time.Minute
+	})
+
+	t.Run("failures lock the client out", func(t *testing.T) {
+		for range 2 {
+			expectStatus(t, s.redeemAs(t, "203.0.113.1", "000000"), http.StatusUnauthorized)
+		}
+		expectRetryAfter(t, s.redeemAs(t, "203.0.113.1", "000000"), 50*time.Second, time.Minute)
+		// A locked out client can't get in even with the right code.
+		pairing, err := s.pairingService.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectStatus(t, s.redeemAs(t, "203.0.113.1", pairing.Code), http.StatusTooManyRequests)
+		expectStatus(t, s.redeemAs(t, "203.0.113.2", pairing.Code), http.StatusOK)
+	})
+
+	t.Run("success resets the count", func(t *testing.T) {
+		expectStatus(t, s.redeemAs(t, "203.0.113.3", "000000"), http.StatusUnauthorized)
+		pairing, err := s.pairingService.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectStatus(t, s.redeemAs(t, "203.0.113.3", pairing.Code), http.StatusOK)
+		expectStatus(t, s.redeemAs(t, "203.0.113.3", "000000"), http.StatusUnauthorized)
+		expectStatus(t, s.redeemAs(t, "203.0.113.3", "000000"), http.StatusUnauthorized)
+	})
+
+	t.Run("share links", func(t *testing.T) {
+		share := func() *http.Response {
+			req := httptest.NewRequest(http.MethodGet, "/share/files/guessed", nil)
+			req.Header.Set("X-Forwarded-For", "203.0.113.4")
+			return s.do(t, req)
+		}
+		for range 2 {
+			expectStatus(t, share(), http.StatusNotFound)
+		}
+		expectStatus(t, share(), http.StatusTooManyRequests)
+		// The share guard counts apart from the login one.
+		expectStatus(t, s.redeemAs(t, "203.0.113.4", "000000"), http.StatusUnauthorized)
+	})
+}
+
+func TestFailureGuardBackoff(t *testing.T) {
+	g := newFailureGuard(2, time.Minute)
+	g.fail("a")
+	if wait := g.lockedFor("a"); wait != 0 {
+		t.Fatalf("locked for %s after one failure", wait)
+	}
+	for want := time.Minute; want <= 8*time.Minute; want *= 2 {
+		g.fail("a")
+		if wait := g.lockedFor("a"); wait <= want-time.Second || wait > want {
+			t.Fatalf("locked for %s, want %s", wait, want)
+		}
+	}
+	for range 20 {
+		g.fail("a")
+	}
+	if wait := g.lockedFor("a"); wait > maxLockoutDuration {
+		t.Errorf("locked for %s, more than the %s cap", wait, maxLockoutDuration)
+	}
+	g.succeed("a")
+	if wait := g.lockedFor("a"); wait != 0 {
+		t.Errorf("locked for %s after a success", wait)
+	}
+}
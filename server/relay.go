@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/service"
+)
+
+const (
+	hubMessageEvent    = "event"
+	hubMessageAll      = "all"
+	hubMessagePolicy   = "policy"
+	hubMessageSettings = "settings"
+	hubMessagePresence = "presence"
+	hubMessageDevice   = "device"
+
+	presenceInterval = 10 * time.Second
+	// presenceExpiry drops the subscribers of an instance that stopped reporting.
+	presenceExpiry = 3 * presenceInterval
+	publishTimeout = 5 * time.Second
+	hubOutboxSize  = 256
+)
+
+// hubMessage tells the other instances sharing the cluster backend what
+// happened here, so their subscribers see it too.
+type hubMessage struct {
+	Origin string `json:"origin"`
+	Kind   string `json:"kind"`
+	// Seq refers to a stored event, which keeps messages small.
+	Seq      int64             `json:"seq,omitempty"`
+	Event    *service.HubEvent `json:"event,omitempty"`
+	Channel  string            `json:"channel,omitempty"`
+	Device   string            `json:"device,omitempty"`
+	Presence *presence         `json:"presence,omitempty"`
+}
+
+// presence counts the subscribers of one instance.
+type presence struct {
+	Devices map[string]int `json:"devices,omitempty"`
+	Rooms   map[string]int `json:"rooms,omitempty"`
+}
+
+type remoteInstance struct {
+	presence
+	expiresAt time.Time
+}
+
+// startRelay receives the hub messages of other instances and reports this
+// one's presence to them until ctx is cancelled.
+func (s *Server) startRelay(ctx context.Context) {
+	s.cluster.Subscribe(s.handleHubMessage)
+	s.hubOutboxDone = make(chan struct{})
+	go s.drainHubOutbox()
+	go s.announcePresence(ctx)
+}
+
+// publishHubMessage queues msg for the other instances. It doesn't wait for
+// the backend and drops msg when the queue is full.
+func (s *Server) publishHubMessage(msg hubMessage) {
+	msg.Origin = s.instanceID
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logrus.Errorln("Encode hub message failed:", err)
+		return
+	}
+	select {
+	case s.hubOutbox <- data:
+	default:
+		logrus.Warnln("Hub message queue full, dropping a", msg.Kind, "message")
+	}
+}
+
+// drainHubOutbox publishes the queued hub messages in order. Once closeHub
+// stops it, it publishes what is left and returns.
+func (s *Server) drainHubOutbox() {
+	defer close(s.hubOutboxDone)
+	for {
+		select {
+		case data := <-s.hubOutbox:
+			s.publish(data)
+		case <-s.hubOutboxStop:
+			for {
+				select {
+				case data := <-s.hubOutbox:
+					s.publish(data)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) publish(data []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := s.cluster.Publish(ctx, data); err != nil {
+		logrus.Errorln("Publish hub message failed:", err)
+	}
+}
+
+// publishEvent sends stored events by sequence number and the rest in full.
+func (s *Server) publishEvent(event service.HubEvent) {
+	if event.Seq != 0 {
+		s.publishHubMessage(hubMessage{Kind: hubMessageEvent, Seq: event.Seq})
+	} else {
+		s.publishHubMessage(hubMessage{Kind: hubMessageEvent, Event: &event})
+	}
+}
+
+// handleHubMessage applies what another instance published to this one.
+func (s *Server) handleHubMessage(data []byte) {
+	var msg hubMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		logrus.Warnln("Invalid hub message:", err)
+		return
+	}
+	if msg.Origin == s.instanceID {
+		return
+	}
+
+	switch msg.Kind {
+	case hubMessageEvent:
+		event := msg.Event
+		if event == nil {
+			stored, err := s.hubEventService.Get(msg.Seq)
+			if err != nil {
+				logrus.Errorln("Load relayed hub event failed:", msg.Seq, err)
+				return
+			}
+			event = &stored
+		}
+		// Like local events, so a joining subscriber gets it from either its replay or live.
+		s.eventsMutex.Lock()
+		s.roomsMutex.Lock()
+		s.deliverEventLocked(*event, nil)
+		s.roomsMutex.Unlock()
+		s.eventsMutex.Unlock()
+	case hubMessageAll:
+		if msg.Event != nil {
+			s.roomsMutex.Lock()
+			s.deliverAllLocked(*msg.Event)
+			s.roomsMutex.Unlock()
+		}
+	case hubMessagePolicy:
+		if err := s.applyChannelPolicy(msg.Channel); err != nil {
+			logrus.Errorln("Reload channel policy failed:", msg.Channel, err)
+		}
+	case hubMessageDevice:
+		s.evictDevice(msg.Device)
+	case hubMessageSettings:
+		if err := s.settingService.Reload(); err != nil {
+			logrus.Errorln("Reload runtime settings failed:", err)
+		}
+	case hubMessagePresence:
+		if msg.Presence != nil {
+			s.roomsMutex.Lock()
+			s.remoteInstances[msg.Origin] = remoteInstance{
+				presence:  *msg.Presence,
+				expiresAt: time.Now().Add(presenceExpiry),
+			}
+			s.roomsMutex.Unlock()
+		}
+	}
+}
+
+// presenceChangedLocked wakes announcePresence. Callers must hold roomsMutex.
+func (s *Server) presenceChangedLocked() {
+	select {
+	case s.presenceChanged <- struct{}{}:
+	default:
+	}
+}
+
+// announcePresence publishes this instance's subscribers whenever they change
+// and every presenceInterval, so the others can tell it is still there.
+func (s *Server) announcePresence(ctx context.Context) {
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.presenceChanged:
+		}
+
+		s.roomsMutex.Lock()
+		if s.hubClosed {
+			s.roomsMutex.Unlock()
+			return
+		}
+		local := presence{
+			Devices: make(map[string]int, len(s.devicePresence)),
+			Rooms:   make(map[string]int, len(s.rooms)),
+		}
+		for deviceID, count := range s.devicePresence {
+			local.Devices[deviceID] = count
+		}
+		for channel, subs := range s.rooms {
+			local.Rooms[channel] = len(subs)
+		}
+		// Queued under the lock so it can't overtake the farewell of closeHub.
+		s.publishHubMessage(hubMessage{Kind: hubMessagePresence, Presence: &local})
+		s.roomsMutex.Unlock()
+	}
+}
+
+// remotePresenceLocked returns the presence of the instances still reporting. Callers must hold roomsMutex.
+func (s *Server) remotePresenceLocked() []presence {
+	now := time.Now()
+	list := make([]presence, 0, len(s.remoteInstances))
+	for origin, remote := range s.remoteInstances {
+		if now.After(remote.expiresAt) {
+			delete(s.remoteInstances, origin)
+			continue
+		}
+		list = append(list, remote.presence)
+	}
+	return list
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zjyl1994/arkdrop/cluster"
+	"github.com/zjyl1994/arkdrop/config"
+)
+
+// localCluster links the instances of a test the way the redis and postgres
+// backends link processes.
+type localCluster struct {
+	mu       sync.Mutex
+	handlers map[*localMember]func(data []byte)
+}
+
+type localMember struct{ *localCluster }
+
+func (c *localCluster) join() cluster.Backend {
+	return &localMember{c}
+}
+
+func (m *localMember) Publish(ctx context.Context, data []byte) error {
+	m.mu.Lock()
+	handlers := make([]func(data []byte), 0, len(m.handlers))
+	for _, handler := range m.handlers {
+		handlers = append(handlers, handler)
+	}
+	m.mu.Unlock()
+	for _, handler := range handlers {
+		handler(data)
+	}
+	return nil
+}
+
+func (m *localMember) Subscribe(handler func(data []byte)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[m] = handler
+}
+
+func (m *localMember) Lead(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (m *localMember) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.handlers, m)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	// Both instances share the database, as the cluster backends require.
+	dataDir := t.TempDir()
+	backend := &localCluster{handlers: make(map[*localMember]func(data []byte))}
+	configure := func(cfg *config.Config) { cfg.DataDir = dataDir }
+	a := newTestInstance(t, backend.join(), configure)
+	b := newTestInstance(t, backend.join(), configure)
+	addr := a.serve(t)
+	phoneID, phone := a.registerTestDevice(t, "phone")
+	laptopID, laptop := a.registerTestDevice(t, "laptop")
+
+	conn := dial(t, addr, "channel=default&since=0", phone)
+	waitFor(t, func() bool { return b.onlineDevices()[phoneID] == 1 })
+	if members := b.roomMembers()[defaultChannel]; members != 1 {
+		t.Errorf("other instance sees %d members, want 1", members)
+	}
+
+	seq := b.postEvent(t, laptop, "channel=default", []byte("from b"))
+	expectEnvelope(t, conn, seq, "from b")
+
+	// Access lists saved on one instance apply on the other at once.
+	admin := a.testToken(t, "", adminUser)
+	expectStatus(t, b.request(t, http.MethodGet, "/api/channel/peers?channel=team", phone, nil), http.StatusOK)
+	resp := a.request(t, http.MethodPost, "/api/channel/save", admin, url.Values{"name": {"team"}, "allowed_devices": {laptopID}})
+	expectStatus(t, resp, http.StatusOK)
+	waitFor(t, func() bool {
+		return b.request(t, http.MethodGet, "/api/channel/peers?channel=team", phone, nil).StatusCode == http.StatusForbidden
+	})
+
+	// A stopping instance takes its subscribers off the others' counts.
+	a.Close()
+	waitFor(t, func() bool { return b.onlineDevices()[phoneID] == 0 })
+}
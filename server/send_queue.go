@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"sync"
+)
+
+// sendQueueLimit bounds the frames waiting for one subscriber: a full replay
+// plus some room for live messages.
+const sendQueueLimit = maxReplayEvents + 256
+
+var errSlowSubscriber = errors.New("subscriber is not keeping up")
+
+// sendQueue buffers the frames of one subscriber for its writer goroutine, so
+// the hub hands frames over without waiting on the network. It grows as
+// needed and refuses frames beyond sendQueueLimit.
+type sendQueue[T any] struct {
+	mu     sync.Mutex
+	frames []T
+	// ready is signalled when frames were pushed since the last take.
+	ready chan struct{}
+}
+
+func newSendQueue[T any]() *sendQueue[T] {
+	return &sendQueue[T]{ready: make(chan struct{}, 1)}
+}
+
+func (q *sendQueue[T]) push(frame T) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.frames) >= sendQueueLimit {
+		return errSlowSubscriber
+	}
+	q.frames = append(q.frames, frame)
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// take removes and returns the queued frames in order.
+func (q *sendQueue[T]) take() []T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	frames := q.frames
+	q.frames = nil
+	return frames
+}
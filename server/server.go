@@ -1,55 +1,321 @@
 package server
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
 	"github.com/gofiber/websocket/v2"
 	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/cluster"
+	"github.com/zjyl1994/arkdrop/config"
+	"github.com/zjyl1994/arkdrop/discovery"
+	"github.com/zjyl1994/arkdrop/metrics"
+	"github.com/zjyl1994/arkdrop/service"
+	"github.com/zjyl1994/arkdrop/utils"
 	"github.com/zjyl1994/arkdrop/vars"
 	"github.com/zjyl1994/arkdrop/webui"
+	"github.com/zjyl1994/cap-go"
+	"golang.org/x/oauth2"
 )
 
-func Run(listen string) error {
-	app := fiber.New(fiber.Config{
+// Server is the HTTP side of one ArkDrop instance: its routes, its hub and
+// everything they keep between requests.
+type Server struct {
+	cfg         *config.Config
+	store       *service.Store
+	metrics     *metrics.Metrics
+	cluster     cluster.Backend
+	app         *fiber.App
+	jwtSecret   []byte
+	capInstance cap.ICap
+
+	parcelService    service.ParcelService
+	auditService     service.AuditService
+	channelService   service.ChannelService
+	clipboardService service.ClipboardService
+	deviceService    service.DeviceService
+	pairingService   service.PairingService
+	passkeyService   service.PasskeyService
+	settingService   service.SettingService
+	adminService     service.AdminService
+	twoFactorService service.TwoFactorService
+	hubEventService  service.HubEventService
+
+	// authSessions holds short-lived state for multi-step login flows such as OIDC and passkeys.
+	// The rate limiters and loginGuard count per instance.
+	authSessions     sessionStorage
+	authLimiter      *rateLimiter
+	shareLimiter     *rateLimiter
+	loginGuard       *failureGuard
+	shareGuard       *failureGuard
+	trustedProxies   []*net.IPNet
+	oidcProvider     *oidc.Provider
+	oidcVerifier     *oidc.IDTokenVerifier
+	oidcOAuth2Config *oauth2.Config
+	webAuthn         *webauthn.WebAuthn
+
+	// setupToken is set while the instance has no admin password yet and is
+	// cleared once the first-run setup succeeds.
+	setupToken string
+	setupMutex sync.Mutex
+
+	channelPolicies       map[string]*channelPolicy
+	channelPoliciesMutex  sync.Mutex
+	channelPoliciesPruned time.Time
+
+	// eventsMutex orders storing events with delivering them and with
+	// replays, without holding roomsMutex during database I/O. It is taken
+	// before roomsMutex.
+	eventsMutex    sync.Mutex
+	rooms          map[string]map[subscriber]bool
+	roomsMutex     sync.Mutex
+	clientSettings map[subscriber]ClientSetting
+	devicePresence map[string]int
+	// replayedUpTo holds the last sequence number replayed to each resuming
+	// subscriber. Another instance may relay an event after it was replayed.
+	replayedUpTo map[subscriber]int64
+	// hubClosed is set on shutdown so late subscribers are turned away.
+	hubClosed bool
+
+	// instanceID tells this instance's hub messages apart from the others'.
+	instanceID string
+	// remoteInstances holds the presence last reported by each other instance, guarded by roomsMutex.
+	remoteInstances map[string]remoteInstance
+	presenceChanged chan struct{}
+	// hubOutbox queues hub messages for drainHubOutbox, so publishing never
+	// blocks a caller holding roomsMutex.
+	hubOutbox     chan []byte
+	hubOutboxStop chan struct{}
+	hubOutboxDone chan struct{}
+
+	advertiser     *discovery.Advertiser
+	redirectServer *http.Server
+
+	// indexHTML is the web UI entry page with the base path filled in.
+	indexHTML []byte
+}
+
+// New prepares an instance serving the data of store. The hub reaches the
+// other instances of a deployment through backend once Start is called.
+func New(cfg *config.Config, store *service.Store, backend cluster.Backend) (*Server, error) {
+	s := &Server{
+		cfg:     cfg,
+		store:   store,
+		metrics: store.Metrics,
+		cluster: backend,
+
+		parcelService:    service.ParcelService{Store: store},
+		auditService:     service.AuditService{Store: store},
+		channelService:   service.ChannelService{Store: store},
+		clipboardService: service.ClipboardService{Store: store},
+		deviceService:    service.DeviceService{Store: store},
+		pairingService:   service.PairingService{Store: store},
+		passkeyService:   service.PasskeyService{Store: store},
+		settingService:   service.SettingService{Store: store},
+		adminService:     service.AdminService{Store: store},
+		twoFactorService: service.TwoFactorService{Store: store},
+		hubEventService:  service.HubEventService{Store: store},
+
+		channelPolicies: make(map[string]*channelPolicy),
+		rooms:           make(map[string]map[subscriber]bool),
+		clientSettings:  make(map[subscriber]ClientSetting),
+		devicePresence:  make(map[string]int),
+		replayedUpTo:    make(map[subscriber]int64),
+		instanceID:      utils.RandString(16),
+		remoteInstances: make(map[string]remoteInstance),
+		presenceChanged: make(chan struct{}, 1),
+		hubOutbox:       make(chan []byte, hubOutboxSize),
+		hubOutboxStop:   make(chan struct{}),
+	}
+	s.authSessions = s.newSessionStorage("session:", 1024*1024)
+	s.capInstance = cap.NewCap(s.newSessionStorage("cap:", int(cfg.CapCacheSize)))
+	var err error
+	if s.trustedProxies, err = parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if err := s.initSigningKey(); err != nil {
+		return nil, err
+	}
+	s.initRateLimiters()
+	if err := s.initOIDC(); err != nil {
+		return nil, err
+	}
+	if err := s.initPasskey(); err != nil {
+		return nil, err
+	}
+	if err := s.initSetup(); err != nil {
+		return nil, err
+	}
+	if err := s.initWebUI(); err != nil {
+		return nil, err
+	}
+	s.metrics.Registry.MustRegister(arkdropCollector{s})
+
+	appConfig := fiber.Config{
 		DisableStartupMessage: true,
-		BodyLimit:             10 * 1024 * 1024,
-	})
+		BodyLimit:             int(cfg.BodyLimit),
+		// Forms are parsed by the handlers, after the upload limit is checked.
+		DisablePreParseMultipartForm: true,
+	}
+	// Only trusted proxies may set X-Forwarded-Proto and -Host. The client
+	// address comes from clientIP, not fiber's leftmost X-Forwarded-For entry.
+	if len(cfg.TrustedProxies) > 0 {
+		appConfig.EnableTrustedProxyCheck = true
+		appConfig.TrustedProxies = cfg.TrustedProxies
+	}
+	s.app = fiber.New(appConfig)
+	s.routes(s.app)
+	return s, nil
+}
 
-	apiGroup := app.Group("/api", AuthMiddleware())
-	apiGroup.Get("/health", HealthHandler)
-	apiGroup.Post("/login", LoginHandler)
-	apiGroup.Post("/cap/challenge", CreateChallenge)
-	apiGroup.Post("/cap/redeem", RedeemChallenge)
-	apiGroup.Post("/create", CreateParcel)
-	apiGroup.Post("/attachment", AddParcelAttachment)
-	apiGroup.Post("/delete", DeleteParcel)
-	apiGroup.Post("/clean", CleanParcel)
-	apiGroup.Get("/list", ListParcel)
-	apiGroup.Post("/favorite", FavoriteParcel)
-	apiGroup.Get("/attachment/share-link", CreateAttachmentShareLink)
-	apiGroup.Get("/ws", websocket.New(WsHandler))
-
-	app.Get("/share/files/:token", DownloadSharedAttachment)
-
-	app.Use("/files", AuthMiddleware())
-	app.Static("/files", filepath.Join(vars.DataDir, "files"), fiber.Static{
-		MaxAge:    int(vars.AutoExpire.Seconds()),
+// App returns the fiber app serving the instance.
+func (s *Server) App() *fiber.App {
+	return s.app
+}
+
+func (s *Server) routes(app *fiber.App) {
+	authRateLimit := s.RateLimitMiddleware(s.authLimiter, s.loginGuard)
+
+	app.Use(s.MetricsMiddleware())
+	app.Use(s.SetupMiddleware)
+
+	// Everything is served under base_path so a reverse proxy can mount ArkDrop on a sub-path.
+	root := app.Group(s.cfg.BasePath)
+
+	if s.cfg.MetricsToken != "" {
+		root.Get("/metrics", s.MetricsHandler())
+	}
+
+	apiGroup := root.Group("/api", s.AuthMiddleware())
+	apiGroup.Get("/health", s.HealthHandler)
+	apiGroup.Post("/login", authRateLimit, s.LoginHandler)
+	apiGroup.Post("/logout", s.LogoutHandler)
+	apiGroup.Get("/setup/status", s.SetupStatus)
+	apiGroup.Post("/setup", authRateLimit, s.CompleteSetup)
+	apiGroup.Post("/cap/challenge", authRateLimit, s.CreateChallenge)
+	apiGroup.Post("/cap/redeem", authRateLimit, s.RedeemChallenge)
+	apiGroup.Get("/oidc/config", s.OIDCConfig)
+	apiGroup.Get("/oidc/login", authRateLimit, s.OIDCLogin)
+	apiGroup.Get("/oidc/callback", authRateLimit, s.OIDCCallback)
+	apiGroup.Get("/passkey/config", s.PasskeyConfig)
+	apiGroup.Post("/passkey/login/begin", authRateLimit, s.BeginPasskeyLogin)
+	apiGroup.Post("/passkey/login/finish", authRateLimit, s.FinishPasskeyLogin)
+	apiGroup.Post("/passkey/register/begin", s.BeginPasskeyRegistration)
+	apiGroup.Post("/passkey/register/finish", s.FinishPasskeyRegistration)
+	apiGroup.Get("/passkey/list", s.ListPasskeys)
+	apiGroup.Post("/passkey/delete", s.DeletePasskey)
+	apiGroup.Post("/device/register", s.RegisterDevice)
+	apiGroup.Get("/device/list", s.ListDevices)
+	apiGroup.Get("/device/presence", s.DevicePresence)
+	apiGroup.Post("/device/rename", s.RenameDevice)
+	apiGroup.Post("/device/delete", s.DeleteDevice)
+	apiGroup.Post("/pair/create", s.CreatePairingCode)
+	apiGroup.Post("/pair/redeem", authRateLimit, s.RedeemPairingCode)
+	apiGroup.Post("/create", s.CreateParcel)
+	apiGroup.Post("/attachment", s.AddParcelAttachment)
+	apiGroup.Post("/delete", s.DeleteParcel)
+	apiGroup.Post("/clean", s.CleanParcel)
+	apiGroup.Get("/list", s.ListParcel)
+	apiGroup.Post("/favorite", s.FavoriteParcel)
+	apiGroup.Get("/attachment/share-link", s.CreateAttachmentShareLink)
+	apiGroup.Get("/2fa/status", s.TwoFactorStatus)
+	apiGroup.Post("/2fa/enroll", s.EnrollTwoFactor)
+	apiGroup.Post("/2fa/confirm", s.ConfirmTwoFactor)
+	apiGroup.Post("/2fa/disable", s.DisableTwoFactor)
+	apiGroup.Get("/audit", s.ListAuditEvents)
+	apiGroup.Get("/audit/export", s.ExportAuditEvents)
+	apiGroup.Get("/settings", s.GetSettings)
+	apiGroup.Post("/settings", s.UpdateSettings)
+	apiGroup.Get("/channel/list", s.ListChannels)
+	apiGroup.Post("/channel/save", s.ChannelAdminMiddleware, s.SaveChannel)
+	apiGroup.Post("/channel/delete", s.ChannelAdminMiddleware, s.DeleteChannel)
+	apiGroup.Get("/channel/peers", s.ChannelAccessMiddleware, s.ListPeers)
+	apiGroup.Get("/webrtc/config", s.WebRTCConfig)
+	apiGroup.Post("/webrtc/complete", s.CompleteDirectTransfer)
+	apiGroup.Get("/ws", s.ChannelAccessMiddleware, websocket.New(s.WsHandler))
+	apiGroup.Get("/events", s.ChannelAccessMiddleware, s.EventStreamHandler)
+	apiGroup.Post("/events", s.ChannelAccessMiddleware, s.PublishEvent)
+
+	root.Get("/share/files/:token", s.RateLimitMiddleware(s.shareLimiter, s.shareGuard), s.CountDownloadBytes("share"), s.DownloadSharedAttachment)
+
+	root.Use("/files", s.AuthMiddleware(), s.CountDownloadBytes("files"), s.FilesCacheControl)
+	root.Static("/files", filepath.Join(s.cfg.DataDir, "files"), fiber.Static{
 		ByteRange: true,
 	})
 
-	app.Use("/", filesystem.New(filesystem.Config{
-		Root:         http.FS(webui.WebUI),
-		PathPrefix:   "dist",
-		NotFoundFile: "dist/index.html",
-		MaxAge:       int(vars.JWT_TOKEN_EXPIRE.Seconds()),
+	// Every page of the web UI, the root included, gets index.html carrying the base path.
+	root.Use("/", filesystem.New(filesystem.Config{
+		Next: func(c *fiber.Ctx) bool {
+			path := s.routePath(c)
+			return path == "/" || path == "/index.html"
+		},
+		Root:       http.FS(webui.WebUI),
+		PathPrefix: "dist",
+		MaxAge:     int(vars.JWT_TOKEN_EXPIRE.Seconds()),
 	}))
-	logrus.Infoln("ArkDrop running on", listen)
-	return app.Listen(listen)
+	root.Get("/*", s.WebUIIndex)
+}
+
+// Start relays hub messages between this instance and the others until ctx is cancelled.
+func (s *Server) Start(ctx context.Context) {
+	s.startRelay(ctx)
+}
+
+// Run serves the instance on its listeners until ctx is cancelled, then stops accepting
+// connections and gives running requests up to shutdown_timeout to finish.
+func (s *Server) Run(ctx context.Context) error {
+	listeners, err := s.listen(s.app)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(listeners))
+	for i, ln := range listeners {
+		names[i] = listenerName(ln)
+	}
+	logrus.Infoln("ArkDrop running on", strings.Join(names, ", "))
+	s.startDiscovery(listeners)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.app.Listener(newMultiListener(listeners))
+	}()
+	select {
+	case err := <-served:
+		s.stopDiscovery()
+		return err
+	case <-ctx.Done():
+	}
+
+	logrus.Infoln("Shutting down, waiting up to", s.cfg.ShutdownTimeout, "for requests to finish.")
+	s.stopDiscovery()
+	s.Close()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	s.stopHTTPRedirect(shutdownCtx)
+	if err := s.app.ShutdownWithContext(shutdownCtx); err != nil {
+		logrus.Warnln("Requests still running after the shutdown timeout:", err)
+	}
+	return nil
+}
+
+// Close disconnects every hub subscriber, turns new ones away and waits for
+// the queued hub messages to be published.
+func (s *Server) Close() {
+	s.closeHub()
+	if s.hubOutboxDone != nil {
+		<-s.hubOutboxDone
+	}
 }
 
-func HealthHandler(c *fiber.Ctx) error {
+func (s *Server) HealthHandler(c *fiber.Ctx) error {
 	return c.SendString("♜ ArkDrop")
 }
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zjyl1994/arkdrop/cluster"
+	"github.com/zjyl1994/arkdrop/config"
+	"github.com/zjyl1994/arkdrop/metrics"
+	"github.com/zjyl1994/arkdrop/migration"
+	"github.com/zjyl1994/arkdrop/service"
+)
+
+const testPassword = "test-password"
+
+// newTestServer starts a server on a fresh SQLite database in a temporary
+// directory. configure, when not nil, adjusts the defaults first.
+func newTestServer(t *testing.T, configure func(cfg *config.Config)) *Server {
+	t.Helper()
+	return newTestInstance(t, cluster.Memory{}, configure)
+}
+
+// newTestInstance is newTestServer for one of several instances sharing backend.
+func newTestInstance(t *testing.T, backend cluster.Backend, configure func(cfg *config.Config)) *Server {
+	t.Helper()
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+	cfg.Password = testPassword
+	cfg.MDNS = false
+	if configure != nil {
+		configure(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(cfg.DataDir, "files"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := service.OpenDB(cfg.DataDir, cfg.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migration.Up(db, migration.Latest()); err != nil {
+		t.Fatal(err)
+	}
+	store := &service.Store{
+		DB:             db,
+		DataDir:        cfg.DataDir,
+		BodyLimit:      int(cfg.BodyLimit),
+		EventRetention: cfg.EventRetention,
+		Metrics:        metrics.New(),
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	err = service.SettingService{Store: store}.Load(service.RuntimeSettings{
+		AutoExpire:           cfg.AutoExpire,
+		AttachmentLinkExpire: cfg.AttachmentLinkExpire,
+		UploadLimit:          cfg.UploadLimit,
+		CleanupInterval:      cfg.CleanupInterval,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(cfg, store, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		s.Close()
+	})
+	return s
+}
+
+// token signs a session the way the login handlers do.
+func (s *Server) testToken(t *testing.T, deviceID, user string) string {
+	t.Helper()
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}
+	if deviceID != "" {
+		claims["device_id"] = deviceID
+	}
+	if user != "" {
+		claims["user"] = user
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// registerTestDevice registers a device and returns its ID and token.
+func (s *Server) registerTestDevice(t *testing.T, name string) (string, string) {
+	t.Helper()
+	device, err := s.deviceService.Register(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return device.ID, s.testToken(t, device.ID, "")
+}
+
+// request sends a request through the fiber app. A non-nil form is sent as
+// an urlencoded body.
+func (s *Server) request(t *testing.T, method, target, token string, form url.Values) *http.Response {
+	t.Helper()
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req := httptest.NewRequest(method, target, body)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return s.do(t, req)
+}
+
+func (s *Server) do(t *testing.T, req *http.Request) *http.Response {
+	t.Helper()
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func expectStatus(t *testing.T, resp *http.Response, want int) {
+	t.Helper()
+	if resp.StatusCode != want {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: status %d %s, want %d", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, body, want)
+	}
+}
+
+// serve makes the server listen on a loopback port, for clients that need a
+// real connection such as websockets and event streams, and returns its address.
+func (s *Server) serve(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.app.Listener(ln) }()
+	// Like Run, disconnect the hub first: open streams would hold up Shutdown.
+	t.Cleanup(func() {
+		s.Close()
+		_ = s.app.Shutdown()
+	})
+	return ln.Addr().String()
+}
+
+// dial opens a hub websocket on the server at addr. query holds the
+// parameters after /api/ws?, token authenticates.
+func dial(t *testing.T, addr, query, token string) *websocket.Conn {
+	t.Helper()
+	header := http.Header{}
+	header.Set("Authorization", token)
+	conn, resp, err := websocket.DefaultDialer.Dial("ws://"+addr+"/api/ws?"+query, header)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial %s: %v, status %d", query, err, status)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// waitFor polls cond until it holds, for state changed by other goroutines.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/service"
+	"github.com/zjyl1994/arkdrop/utils"
+)
+
+// settingsView shows runtime settings in the same syntax the config file uses.
+type settingsView struct {
+	AutoExpire           string `json:"auto_expire"`
+	AttachmentLinkExpire string `json:"attachment_link_expire"`
+	UploadLimit          string `json:"upload_limit"`
+	CleanupInterval      string `json:"cleanup_interval"`
+	MaxUploadLimit       string `json:"max_upload_limit"`
+}
+
+func (s *Server) newSettingsView(settings service.RuntimeSettings) settingsView {
+	return settingsView{
+		AutoExpire:           utils.FormatDuration(settings.AutoExpire),
+		AttachmentLinkExpire: utils.FormatDuration(settings.AttachmentLinkExpire),
+		UploadLimit:          utils.FormatSize(settings.UploadLimit),
+		CleanupInterval:      utils.FormatDuration(settings.CleanupInterval),
+		MaxUploadLimit:       utils.FormatSize(s.cfg.BodyLimit),
+	}
+}
+
+func (s *Server) GetSettings(c *fiber.Ctx) error {
+	return c.JSON(s.newSettingsView(s.store.CurrentSettings()))
+}
+
+// UpdateSettings changes the runtime settings given in the form, leaving the others as they are.
+func (s *Server) UpdateSettings(c *fiber.Ctx) error {
+	var change service.RuntimeSettingsChange
+	changed := make(map[string]any)
+
+	durations := []struct {
+		key    string
+		target **time.Duration
+	}{
+		{"auto_expire", &change.AutoExpire},
+		{"attachment_link_expire", &change.AttachmentLinkExpire},
+		{"cleanup_interval", &change.CleanupInterval},
+	}
+	for _, field := range durations {
+		raw := c.FormValue(field.key)
+		if raw == "" {
+			continue
+		}
+		value, err := utils.ParseDuration(raw)
+		if err != nil || value < time.Second {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "invalid " + field.key + ", expect a duration of at least 1s",
+			})
+		}
+		*field.target = &value
+		changed[field.key] = utils.FormatDuration(value)
+	}
+
+	if raw := c.FormValue("upload_limit"); raw != "" {
+		value, err := utils.ParseSize(raw)
+		if err != nil || value <= 0 || value > s.cfg.BodyLimit {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "invalid upload_limit, expect a size up to " + utils.FormatSize(s.cfg.BodyLimit),
+			})
+		}
+		change.UploadLimit = &value
+		changed["upload_limit"] = utils.FormatSize(value)
+	}
+
+	if len(changed) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "no setting given",
+		})
+	}
+	settings, err := s.settingService.Update(change)
+	if err != nil {
+		return err
+	}
+	s.publishHubMessage(hubMessage{Kind: hubMessageSettings})
+	s.recordAudit(c, service.AuditSettingsUpdate, 0, changed)
+
+	view := s.newSettingsView(settings)
+	notification, err := json.Marshal(fiber.Map{
+		"type":     "settings_changed",
+		"settings": view,
+	})
+	if err != nil {
+		logrus.Errorln("Encode settings notification failed:", err)
+	} else {
+		s.broadcastAll(websocket.TextMessage, notification)
+	}
+	return c.JSON(view)
+}
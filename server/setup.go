@@ -0,0 +1,115 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/service"
+)
+
+var setupPaths = map[string]bool{
+	"/api/health":       true,
+	"/api/setup":        true,
+	"/api/setup/status": true,
+}
+
+func (s *Server) initSetup() error {
+	if s.cfg.Password != "" {
+		return nil
+	}
+	configured, err := s.adminService.Configured()
+	if err != nil || configured {
+		return err
+	}
+
+	token, err := s.adminService.SetupToken()
+	if err != nil {
+		return err
+	}
+	s.setupMutex.Lock()
+	s.setupToken = token
+	s.setupMutex.Unlock()
+	logrus.Warnln("No admin password is configured, the API is closed until setup is finished.")
+	logrus.Warnln("Open "+s.cfg.BasePath+"/setup in the web UI and enter the setup token:", s.setupToken)
+	return nil
+}
+
+// setupPending reports whether the setup is still to be done. Another instance
+// may have finished it, so the database is asked while it looks pending here.
+func (s *Server) setupPending() bool {
+	s.setupMutex.Lock()
+	defer s.setupMutex.Unlock()
+	if s.setupToken == "" {
+		return false
+	}
+	configured, err := s.adminService.Configured()
+	if err != nil {
+		logrus.Errorln("Check admin password failed:", err)
+		return true
+	}
+	if configured {
+		s.setupToken = ""
+	}
+	return s.setupToken != ""
+}
+
+// SetupMiddleware refuses the API, files and share links until the first-run
+// setup stored an admin password. The web UI itself stays reachable.
+func (s *Server) SetupMiddleware(c *fiber.Ctx) error {
+	path := s.routePath(c)
+	if setupPaths[path] || !s.setupPending() {
+		return c.Next()
+	}
+	for _, prefix := range []string{"/api", "/files", "/share", "/metrics"} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"message":        "setup required",
+				"setup_required": true,
+			})
+		}
+	}
+	return c.Next()
+}
+
+func (s *Server) SetupStatus(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"setup_required": s.setupPending()})
+}
+
+func (s *Server) CompleteSetup(c *fiber.Ctx) error {
+	token := c.FormValue("token")
+	password := c.FormValue("password")
+
+	s.setupMutex.Lock()
+	defer s.setupMutex.Unlock()
+	if s.setupToken == "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "setup already completed"})
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.setupToken)) == 0 {
+		s.loginGuard.fail(s.clientIP(c))
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "invalid setup token"})
+	}
+	if weakness := service.PasswordWeakness(password); weakness != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "password rejected, " + weakness})
+	}
+
+	if err := s.adminService.Setup(password); err != nil {
+		if errors.Is(err, service.ErrSetupDone) {
+			s.setupToken = ""
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "setup already completed"})
+		}
+		return err
+	}
+	s.setupToken = ""
+	s.loginGuard.succeed(s.clientIP(c))
+	s.recordAudit(c, service.AuditSetupComplete, 0, nil)
+	logrus.Infoln("Admin password set, setup finished.")
+
+	tokenString, err := s.issueToken(c, false, adminUser)
+	if err != nil {
+		return err
+	}
+	return c.SendString(tokenString)
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/zjyl1994/arkdrop/service"
+	"gorm.io/gorm"
+)
+
+const signalMessageType = "signal"
+
+// Signals exchanged between peers, plus the one the server answers with when
+// the addressed peer is not in the channel so the sender can fall back to an upload.
+const (
+	signalOffer       = "offer"
+	signalAnswer      = "answer"
+	signalICE         = "ice"
+	signalBye         = "bye"
+	signalUnavailable = "unavailable"
+)
+
+var (
+	errInvalidSignal   = errors.New("invalid signal message")
+	errPeerUnavailable = errors.New("peer unavailable")
+)
+
+// signalMessage is a WebRTC signaling message. Unlike other hub traffic it is
+// relayed to a single peer of the channel and never persisted. Payload carries
+// the SDP or ICE candidate untouched.
+type signalMessage struct {
+	Type       string          `json:"type"`
+	Signal     string          `json:"signal"`
+	From       string          `json:"from,omitempty"`
+	To         string          `json:"to"`
+	TransferID string          `json:"transfer_id,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+type peerItem struct {
+	PeerID     string `json:"peer_id"`
+	DeviceID   string `json:"device_id,omitempty"`
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+type transferFile struct {
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+type transferReport struct {
+	TransferID   string         `json:"transfer_id"`
+	TargetDevice string         `json:"target_device"`
+	Files        []transferFile `json:"files"`
+}
+
+func parseSignal(msgType int, message []byte) (signalMessage, bool) {
+	if msgType != websocket.TextMessage || !strings.HasPrefix(strings.TrimSpace(string(message)), "{") {
+		return signalMessage{}, false
+	}
+	var signal signalMessage
+	if err := json.Unmarshal(message, &signal); err != nil || signal.Type != signalMessageType {
+		return signalMessage{}, false
+	}
+	return signal, true
+}
+
+// relaySignal hands signal to the peers of channel it is addressed to. A
+// connected sender is told through an "unavailable" signal when nobody is
+// there; other callers get errPeerUnavailable.
+func (s *Server) relaySignal(channel string, signal signalMessage, sender subscriber) error {
+	if sender != nil {
+		signal.From = sender.peer()
+	}
+	switch signal.Signal {
+	case signalOffer, signalAnswer, signalICE, signalBye:
+	default:
+		return errInvalidSignal
+	}
+	if signal.To == "" || signal.From == "" {
+		return errInvalidSignal
+	}
+	payload, err := json.Marshal(signal)
+	if err != nil {
+		return err
+	}
+
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	event := service.HubEvent{
+		Channel: channel,
+		MsgType: websocket.TextMessage,
+		Payload: payload,
+	}
+	if sender != nil {
+		event.SourceDeviceID = sender.device()
+	}
+	delivered := false
+	for sub := range s.rooms[channel] {
+		if sub == sender || sub.peer() != signal.To {
+			continue
+		}
+		s.deliverLocked(sub, event)
+		delivered = true
+	}
+	if delivered {
+		return nil
+	}
+	if sender == nil {
+		return errPeerUnavailable
+	}
+
+	reply, err := json.Marshal(signalMessage{
+		Type:       signalMessageType,
+		Signal:     signalUnavailable,
+		From:       signal.To,
+		To:         signal.From,
+		TransferID: signal.TransferID,
+	})
+	if err != nil {
+		return err
+	}
+	s.deliverLocked(sender, service.HubEvent{
+		Channel: channel,
+		MsgType: websocket.TextMessage,
+		Payload: reply,
+	})
+	return nil
+}
+
+// ListPeers returns the addressable subscribers of a channel.
+func (s *Server) ListPeers(c *fiber.Ctx) error {
+	access := c.Locals("channel").(*channelAccess)
+	devices, err := s.deviceService.List()
+	if err != nil {
+		return err
+	}
+	deviceNames := make(map[string]string, len(devices))
+	for _, device := range devices {
+		deviceNames[device.ID] = device.Name
+	}
+
+	s.roomsMutex.Lock()
+	list := make([]peerItem, 0, len(s.rooms[access.channel]))
+	seen := make(map[string]bool)
+	for sub := range s.rooms[access.channel] {
+		if sub.peer() == "" || seen[sub.peer()] {
+			continue
+		}
+		seen[sub.peer()] = true
+		list = append(list, peerItem{
+			PeerID:     sub.peer(),
+			DeviceID:   sub.device(),
+			DeviceName: deviceNames[sub.device()],
+		})
+	}
+	s.roomsMutex.Unlock()
+
+	return c.JSON(fiber.Map{
+		"list": list,
+	})
+}
+
+// WebRTCConfig tells clients which ICE servers to use. Without any, only
+// direct LAN candidates work and clients fall back to a regular upload.
+func (s *Server) WebRTCConfig(c *fiber.Ctx) error {
+	iceServers := make([]fiber.Map, 0, 1)
+	if len(s.cfg.WebRTCICEServers) > 0 {
+		iceServers = append(iceServers, fiber.Map{"urls": s.cfg.WebRTCICEServers})
+	}
+	return c.JSON(fiber.Map{
+		"ice_servers": iceServers,
+		"fallback":    "upload",
+	})
+}
+
+// CompleteDirectTransfer records a finished peer-to-peer transfer as a
+// metadata-only parcel. Both ends may report it; the transfer ID keeps one.
+func (s *Server) CompleteDirectTransfer(c *fiber.Ctx) error {
+	var report transferReport
+	if err := c.BodyParser(&report); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "invalid transfer report",
+		})
+	}
+	if !service.ValidChannelName(report.TransferID) || len(report.TransferID) > 32 || len(report.Files) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "invalid transfer report",
+		})
+	}
+	if report.TargetDevice != "" {
+		if _, err := s.deviceService.Get(report.TargetDevice); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"message": "unknown target device",
+				})
+			}
+			return err
+		}
+	}
+
+	lines := make([]string, 0, len(report.Files))
+	for _, file := range report.Files {
+		lines = append(lines, fmt.Sprintf("%s (%d bytes)", file.Name, file.Size))
+	}
+	parcel, created, err := s.parcelService.RecordTransfer(service.Parcel{
+		Content:        "Direct transfer:\n" + strings.Join(lines, "\n"),
+		SourceDeviceID: currentDeviceID(c),
+		TargetDeviceID: report.TargetDevice,
+		TransferID:     report.TransferID,
+	})
+	if err != nil {
+		return err
+	}
+	if created {
+		s.recordAudit(c, service.AuditDirectTransfer, parcel.ID, map[string]any{
+			"transfer_id":   report.TransferID,
+			"target_device": report.TargetDevice,
+			"files":         report.Files,
+		})
+		if parcel.TargetDeviceID != "" {
+			s.sendToDevice(parcel.TargetDeviceID, websocket.TextMessage, []byte("list_change"))
+		} else {
+			s.broadcastToRoom(defaultChannel, websocket.TextMessage, []byte("list_change"), nil, parcel.SourceDeviceID)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"id": parcel.ID,
+	})
+}
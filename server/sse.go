@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/service"
+)
+
+const (
+	sseHeartbeatInterval = 15 * time.Second
+	sseRetryMillis       = 3000
+)
+
+// sseSubscriber streams hub events to an EventSource client. Text messages are
+// sent as "message" events, binary ones as base64 encoded "binary" events, and
+// every event carries its sequence number as the SSE id. A replay cut short at
+// maxReplayEvents ends with a "truncated" event; resuming from its id gets the rest.
+type sseSubscriber struct {
+	w        *bufio.Writer
+	channel  string
+	deviceID string
+	userName string
+	peerID   string
+	// send holds the frames the hub delivered until the stream writes them.
+	send      *sendQueue[string]
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *Server) EventStreamHandler(c *fiber.Ctx) error {
+	access := c.Locals("channel").(*channelAccess)
+	channel := access.channel
+	echo, _ := strconv.ParseBool(c.Query("echo"))
+
+	// EventSource sends Last-Event-ID on reconnect; ?since= lets a fresh client resume too.
+	rawSince := c.Get("Last-Event-ID")
+	if rawSince == "" {
+		rawSince = c.Query("since")
+	}
+	since, sinceErr := strconv.ParseInt(rawSince, 10, 64)
+	setting := ClientSetting{Echo: echo, Resume: sinceErr == nil && since >= 0}
+
+	sub := &sseSubscriber{
+		channel:  channel,
+		deviceID: currentDeviceID(c),
+		userName: access.user,
+		peerID:   access.peer,
+		send:     newSendQueue[string](),
+		done:     make(chan struct{}),
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		sub.w = w
+		if _, err := w.WriteString("retry: " + strconv.Itoa(sseRetryMillis) + "\n\n"); err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		if err := s.joinRoom(sub, setting, since); err != nil {
+			logrus.Debugln("Event stream replay failed: ", err)
+			return
+		}
+		s.touchDevice(sub.deviceID)
+		defer func() {
+			s.leaveRoom(sub)
+			s.touchDevice(sub.deviceID)
+		}()
+
+		logrus.Debugln("Event stream client join: ", channel)
+
+		ticker := time.NewTicker(sseHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sub.done:
+				return
+			case <-sub.send.ready:
+				if err := sub.write(sub.send.take()...); err != nil {
+					logrus.Debugln("Event stream link error or disconnect: ", err)
+					return
+				}
+			case <-ticker.C:
+				if err := sub.heartbeat(); err != nil {
+					logrus.Debugln("Event stream link error or disconnect: ", err)
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// PublishEvent relays the request body to a channel, since SSE clients cannot talk back over their stream.
+func (s *Server) PublishEvent(c *fiber.Ctx) error {
+	access := c.Locals("channel").(*channelAccess)
+	policy, err := s.loadChannelPolicy(access.channel)
+	if err != nil {
+		return err
+	}
+	if policy.tooLarge(len(c.Body())) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"message": "message too large",
+		})
+	}
+	if wait := policy.limiter.allow(access.sender); wait > 0 {
+		return tooManyRequests(c, wait)
+	}
+
+	msgType := websocket.TextMessage
+	if binary, _ := strconv.ParseBool(c.Query("binary")); binary {
+		msgType = websocket.BinaryMessage
+	}
+	// Copy the body, fasthttp reuses its buffer once the handler returns.
+	message := append([]byte(nil), c.Body()...)
+
+	if signal, ok := parseSignal(msgType, message); ok {
+		signal.From = access.peer
+		if err := s.relaySignal(access.channel, signal, nil); err != nil {
+			status := fiber.StatusBadRequest
+			if errors.Is(err, errPeerUnavailable) {
+				status = fiber.StatusNotFound
+			}
+			return c.Status(status).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		return c.JSON(fiber.Map{
+			"seq": 0,
+		})
+	}
+
+	seq, err := s.relayMessage(access.channel, msgType, message, nil, currentDeviceID(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"seq": seq,
+	})
+}
+
+func (sub *sseSubscriber) room() string {
+	return sub.channel
+}
+
+func (sub *sseSubscriber) device() string {
+	return sub.deviceID
+}
+
+func (sub *sseSubscriber) user() string {
+	return sub.userName
+}
+
+func (sub *sseSubscriber) peer() string {
+	return sub.peerID
+}
+
+// close ends the stream; SSE has no close codes, so code and reason are dropped.
+func (sub *sseSubscriber) close(_ int, _ string) {
+	sub.closeOnce.Do(func() {
+		close(sub.done)
+	})
+}
+
+func (sub *sseSubscriber) deliver(_ ClientSetting, event service.HubEvent) error {
+	var frame strings.Builder
+	if event.Seq > 0 {
+		frame.WriteString("id: " + strconv.FormatInt(event.Seq, 10) + "\n")
+	}
+	if event.MsgType == websocket.BinaryMessage {
+		frame.WriteString("event: binary\ndata: " + base64.StdEncoding.EncodeToString(event.Payload) + "\n")
+	} else {
+		frame.WriteString("event: message\n")
+		for _, line := range strings.Split(string(event.Payload), "\n") {
+			frame.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+		}
+	}
+	frame.WriteString("\n")
+	return sub.send.push(frame.String())
+}
+
+func (sub *sseSubscriber) replayTruncated(seq int64) error {
+	id := strconv.FormatInt(seq, 10)
+	return sub.send.push("id: " + id + "\nevent: truncated\ndata: " + id + "\n\n")
+}
+
+// heartbeat sends a comment line so idle proxies keep the stream open and dead peers get noticed.
+func (sub *sseSubscriber) heartbeat() error {
+	return sub.write(": ping\n\n")
+}
+
+// write sends frames from the stream goroutine, the only one using w.
+func (sub *sseSubscriber) write(frames ...string) error {
+	for _, frame := range frames {
+		if _, err := sub.w.WriteString(frame); err != nil {
+			return err
+		}
+	}
+	return sub.w.Flush()
+}
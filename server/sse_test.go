@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// openStream subscribes to /api/events?query on the server at addr.
+// lastEventID, when set, is sent the way a reconnecting EventSource does.
+func openStream(t *testing.T, addr, query, token, lastEventID string) *bufio.Reader {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/api/events?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// readEvent returns the next event on stream, skipping the retry hint and comments.
+func readEvent(t *testing.T, stream *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	var data []string
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			event.id = value
+		case "event":
+			event.event = value
+		case "data":
+			data = append(data, value)
+		case "":
+			if event.event != "" {
+				event.data = strings.Join(data, "\n")
+				return event
+			}
+		}
+	}
+}
+
+func expectEvent(t *testing.T, stream *bufio.Reader, want sseEvent) {
+	t.Helper()
+	if event := readEvent(t, stream); event != want {
+		t.Fatalf("event = %+v, want %+v", event, want)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	s := newTestServer(t, nil)
+	addr := s.serve(t)
+	phoneID, phone := s.registerTestDevice(t, "phone")
+	_, laptop := s.registerTestDevice(t, "laptop")
+
+	stream := openStream(t, addr, "channel=default", phone, "")
+	waitFor(t, func() bool { return s.onlineDevices()[phoneID] > 0 })
+	text := strconv.FormatInt(s.postEvent(t, laptop, "channel=default", []byte("line one\r\nline two")), 10)
+	expectEvent(t, stream, sseEvent{id: text, event: "message", data: "line one\nline two"})
+	binary := strconv.FormatInt(s.postEvent(t, laptop, "channel=default&binary=1", []byte{0, 1, 2}), 10)
+	expectEvent(t, stream, sseEvent{id: binary, event: "binary", data: "AAEC"})
+
+	// A reconnecting EventSource resumes after the last id it saw, a new one with ?since=.
+	missed := strconv.FormatInt(s.postEvent(t, laptop, "channel=default", []byte("missed")), 10)
+	expectEvent(t, openStream(t, addr, "channel=default", phone, binary), sseEvent{id: missed, event: "message", data: "missed"})
+	resumed := openStream(t, addr, "channel=default&since="+text, phone, "")
+	expectEvent(t, resumed, sseEvent{id: binary, event: "binary", data: "AAEC"})
+	expectEvent(t, resumed, sseEvent{id: missed, event: "message", data: "missed"})
+}
+
+func TestEventStreamReplayTruncated(t *testing.T) {
+	s := newTestServer(t, nil)
+	addr := s.serve(t)
+	_, phone := s.registerTestDevice(t, "phone")
+	last := s.appendEvents(t, defaultChannel, maxReplayEvents+1)
+
+	stream := openStream(t, addr, "channel=default", phone, "0")
+	var id string
+	for range maxReplayEvents {
+		id = readEvent(t, stream).id
+	}
+	expectEvent(t, stream, sseEvent{id: id, event: "truncated", data: id})
+
+	stream = openStream(t, addr, "channel=default", phone, id)
+	expectEvent(t, stream, sseEvent{id: strconv.FormatInt(last, 10), event: "message", data: strconv.Itoa(maxReplayEvents)})
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/utils"
+	"github.com/zjyl1994/arkdrop/vars"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	selfSignedValidity = 5 * 365 * 24 * time.Hour
+	// selfSignedRenewBefore regenerates the certificate ahead of expiry, which changes its fingerprint.
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+)
+
+// listen opens the listeners for app, all over TLS unless it is turned off,
+// and starts the HTTP to HTTPS redirect listener when one is configured.
+func (s *Server) listen(app *fiber.App) ([]net.Listener, error) {
+	listeners, err := s.openListeners(app.Config().Network)
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.TLSMode == vars.TLS_MODE_OFF {
+		return listeners, nil
+	}
+
+	tlsConfig, challengeHandler, err := s.buildTLSConfig()
+	if err != nil {
+		for _, ln := range listeners {
+			_ = ln.Close()
+		}
+		return nil, err
+	}
+	if s.cfg.HTTPRedirectAddr != "" {
+		s.redirectServer = newHTTPRedirectServer(s.cfg.HTTPRedirectAddr, httpsPort(listeners), challengeHandler)
+		go serveHTTPRedirect(s.redirectServer)
+	}
+	for i, ln := range listeners {
+		listeners[i] = tls.NewListener(ln, tlsConfig)
+	}
+	return listeners, nil
+}
+
+// httpsPort is the port of the first TCP listener, where redirects send clients.
+func httpsPort(listeners []net.Listener) string {
+	for _, ln := range listeners {
+		if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+			return strconv.Itoa(addr.Port)
+		}
+	}
+	return ""
+}
+
+// buildTLSConfig returns the TLS configuration of the active mode and, for
+// ACME, the handler answering HTTP-01 challenges on the redirect listener.
+func (s *Server) buildTLSConfig() (*tls.Config, func(http.Handler) http.Handler, error) {
+	switch s.cfg.TLSMode {
+	case vars.TLS_MODE_FILE:
+		cert, err := tls.LoadX509KeyPair(s.cfg.TLSCert, s.cfg.TLSKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		logCertificateFingerprint(cert)
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil, nil
+	case vars.TLS_MODE_SELF_SIGNED:
+		cert, err := s.loadSelfSignedCertificate()
+		if err != nil {
+			return nil, nil, err
+		}
+		logCertificateFingerprint(cert)
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil, nil
+	case vars.TLS_MODE_ACME:
+		manager, err := s.newACMEManager()
+		if err != nil {
+			return nil, nil, err
+		}
+		logrus.Infoln("Requesting ACME certificates for", strings.Join(s.cfg.ACMEDomains, ", "), "from", s.cfg.ACMEDirectory)
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		// Handshake failures never reach the server log otherwise.
+		getCertificate := tlsConfig.GetCertificate
+		tlsConfig.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := getCertificate(hello)
+			if err != nil {
+				logrus.Warnln("ACME certificate for", hello.ServerName, "unavailable:", err)
+			}
+			return cert, err
+		}
+		return tlsConfig, manager.HTTPHandler, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown TLS mode %q", s.cfg.TLSMode)
+	}
+}
+
+func (s *Server) newACMEManager() (*autocert.Manager, error) {
+	client := &acme.Client{DirectoryURL: s.cfg.ACMEDirectory}
+	// A private CA such as a local Pebble server signs its directory with its own root.
+	if s.cfg.ACMECA != "" {
+		caPEM, err := os.ReadFile(s.cfg.ACMECA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificate found in %s", s.cfg.ACMECA)
+		}
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		}
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(filepath.Join(s.cfg.DataDir, "tls", "acme")),
+		HostPolicy: autocert.HostWhitelist(s.cfg.ACMEDomains...),
+		Email:      s.cfg.ACMEEmail,
+		Client:     client,
+	}, nil
+}
+
+// newHTTPRedirectServer sends plain HTTP clients to the HTTPS listener. With
+// ACME it also answers HTTP-01 challenges.
+func newHTTPRedirectServer(addr, tlsPort string, challengeHandler func(http.Handler) http.Handler) *http.Server {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	if challengeHandler != nil {
+		handler = challengeHandler(handler)
+	}
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+func serveHTTPRedirect(server *http.Server) {
+	logrus.Infoln("Redirecting HTTP on", server.Addr, "to HTTPS")
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logrus.Errorln("HTTP redirect listener failed:", err)
+	}
+}
+
+func (s *Server) stopHTTPRedirect(ctx context.Context) {
+	if s.redirectServer == nil {
+		return
+	}
+	if err := s.redirectServer.Shutdown(ctx); err != nil {
+		logrus.Warnln("Stop HTTP redirect listener failed:", err)
+	}
+}
+
+// loadSelfSignedCertificate reuses the certificate kept in the data dir so its
+// fingerprint stays stable for pinning, generating a new one when missing or about to expire.
+func (s *Server) loadSelfSignedCertificate() (tls.Certificate, error) {
+	dir := filepath.Join(s.cfg.DataDir, "tls")
+	certPath := filepath.Join(dir, "self-signed.crt")
+	keyPath := filepath.Join(dir, "self-signed.key")
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil && time.Until(cert.Leaf.NotAfter) > selfSignedRenewBefore {
+		return cert, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return tls.Certificate{}, err
+	}
+
+	logrus.Infoln("Generating self-signed TLS certificate in", dir)
+	certPEM, keyPEM, err := s.generateSelfSignedCertificate()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+func (s *Server) generateSelfSignedCertificate() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	dnsNames := []string{"localhost"}
+	if hostname != "" {
+		dnsNames = append(dnsNames, hostname)
+	}
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if lanIPs, err := utils.LANAddrs(); err == nil {
+		ips = append(ips, lanIPs...)
+	}
+	for _, host := range s.cfg.TLSHosts {
+		if ip := net.ParseIP(host); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, host)
+		}
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "ArkDrop", Organization: []string{"ArkDrop"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// certificateFingerprint formats the SHA-256 digest of the leaf certificate the way browsers display it.
+func certificateFingerprint(cert tls.Certificate) string {
+	sum := sha256.Sum256(cert.Certificate[0])
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func logCertificateFingerprint(cert tls.Certificate) {
+	logrus.Infoln("TLS certificate SHA-256 fingerprint:", certificateFingerprint(cert))
+}
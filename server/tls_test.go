@@ -0,0 +1,178 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zjyl1994/arkdrop/config"
+)
+
+func TestSelfSignedCertificate(t *testing.T) {
+	dataDir := t.TempDir()
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.DataDir = dataDir
+		cfg.TLSMode = config.TLSModeSelfSigned
+		cfg.TLSHosts = []string{"arkdrop.lan", "192.0.2.10"}
+	})
+	tlsConfig, challengeHandler, err := s.buildTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challengeHandler != nil {
+		t.Error("self-signed mode answers ACME challenges")
+	}
+	cert := tlsConfig.Certificates[0]
+	if !slices.Contains(cert.Leaf.DNSNames, "arkdrop.lan") || !slices.ContainsFunc(cert.Leaf.IPAddresses, func(ip net.IP) bool { return ip.String() == "192.0.2.10" }) {
+		t.Errorf("certificate for %v %v misses the tls_hosts", cert.Leaf.DNSNames, cert.Leaf.IPAddresses)
+	}
+	keyPath := filepath.Join(dataDir, "tls", "self-signed.key")
+	if info, err := os.Stat(keyPath); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("private key: %v, %v", info, err)
+	}
+
+	// The certificate is kept, so pinned fingerprints stay valid across restarts.
+	again, _, err := s.buildTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certificateFingerprint(again.Certificates[0]) != certificateFingerprint(cert) {
+		t.Error("self-signed certificate changed on reload")
+	}
+
+	// The same pair serves in file mode.
+	s.cfg.TLSMode = config.TLSModeFile
+	s.cfg.TLSCert = filepath.Join(dataDir, "tls", "self-signed.crt")
+	s.cfg.TLSKey = keyPath
+	fromFile, _, err := s.buildTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certificateFingerprint(fromFile.Certificates[0]) != certificateFingerprint(cert) {
+		t.Error("file mode loaded another certificate")
+	}
+}
+
+// TestACME obtains a certificate from a Pebble test CA. It runs when
+// PEBBLE_DIRECTORY names the directory and PEBBLE_CA the root Pebble serves it
+// with, e.g.
+//
+//	PEBBLE_VA_ALWAYS_VALID=1 pebble -config test/config/pebble-config.json
+//	PEBBLE_DIRECTORY=https://localhost:14000/dir PEBBLE_CA=test/certs/pebble.minica.pem go test ./server -run TestACME
+//
+// Pebble is told to skip validation since it can't reach the test listener.
+func TestACME(t *testing.T) {
+	directory, ca := os.Getenv("PEBBLE_DIRECTORY"), os.Getenv("PEBBLE_CA")
+	if directory == "" || ca == "" {
+		t.Skip("PEBBLE_DIRECTORY and PEBBLE_CA not set")
+	}
+	directory, ca = pebbleProxy(t, directory, ca)
+	const domain = "arkdrop.test"
+	dataDir := t.TempDir()
+	configure := func(cfg *config.Config) {
+		cfg.DataDir = dataDir
+		cfg.Listen = []string{"127.0.0.1:0"}
+		cfg.TLSMode = config.TLSModeACME
+		cfg.ACMEDomains = []string{domain}
+		cfg.ACMEEmail = "admin@" + domain
+		cfg.ACMEDirectory = directory
+		cfg.ACMECA = ca
+	}
+	// handshake serves s over TLS and returns the certificate a client sees for domain.
+	handshake := func(s *Server, serverName string) ([]byte, error) {
+		listeners, err := s.listen(s.app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() { _ = s.app.Listener(listeners[0]) }()
+		defer func() { _ = s.app.Shutdown() }()
+
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: time.Minute}, "tcp", listeners[0].Addr().String(), &tls.Config{
+			ServerName: serverName,
+			// Pebble's issuing root is generated at startup, so only the names are checked.
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		leaf := conn.ConnectionState().PeerCertificates[0]
+		if !slices.Contains(leaf.DNSNames, domain) || !strings.Contains(leaf.Issuer.CommonName, "Pebble") {
+			t.Errorf("certificate for %v issued by %q", leaf.DNSNames, leaf.Issuer.CommonName)
+		}
+		return leaf.Raw, nil
+	}
+
+	s := newTestServer(t, configure)
+	issued, err := handshake(s, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handshake(s, "other.test"); err == nil {
+		t.Error("got a certificate for a domain outside acme_domains")
+	}
+
+	// A restart serves the cached certificate instead of ordering a new one.
+	restarted := newTestServer(t, configure)
+	cached, err := handshake(restarted, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cached, issued) {
+		t.Error("restart ordered a new certificate instead of using the cache")
+	}
+}
+
+// pebbleProxy serves the Pebble directory through a proxy with its own
+// certificate and returns the proxied directory and that certificate's file.
+// Pebble finalizes orders in the background and answers with a processing
+// order that lacks the Location header x/crypto/acme polls, so the proxy adds it.
+func pebbleProxy(t *testing.T, directory, caFile string) (string, string) {
+	t.Helper()
+	target, err := url.Parse(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		t.Fatalf("no certificate found in %s", caFile)
+	}
+	proxy := httptest.NewTLSServer(&httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.Scheme = target.Scheme
+			r.Out.URL.Host = target.Host
+			// Pebble builds its URLs from Host, so they keep leading here.
+			r.Out.Host = r.In.Host
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			if id, ok := strings.CutPrefix(resp.Request.URL.Path, "/finalize-order/"); ok && resp.Header.Get("Location") == "" {
+				resp.Header.Set("Location", "https://"+resp.Request.Host+"/my-order/"+id)
+			}
+			return nil
+		},
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	})
+	t.Cleanup(proxy.Close)
+
+	proxyCA := filepath.Join(t.TempDir(), "proxy.pem")
+	err = os.WriteFile(proxyCA, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: proxy.Certificate().Raw}), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxy.URL + target.Path, proxyCA
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/zjyl1994/arkdrop/service"
+)
+
+func (s *Server) TwoFactorStatus(c *fiber.Ctx) error {
+	enabled, err := s.twoFactorService.Enabled()
+	if err != nil {
+		return err
+	}
+	remaining, err := s.twoFactorService.RemainingRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{
+		"enabled":                  enabled,
+		"remaining_recovery_codes": remaining,
+	})
+}
+
+// verifyCurrentOTP checks field against the active second factor when 2FA is
+// enabled, so a stolen session can't replace or remove it. It writes the
+// error response itself and reports whether the handler may go on.
+func (s *Server) verifyCurrentOTP(c *fiber.Ctx, field string) (bool, error) {
+	enabled, err := s.twoFactorService.Enabled()
+	if err != nil || !enabled {
+		return err == nil, err
+	}
+	if err := s.twoFactorService.Verify(c.FormValue(field)); err != nil {
+		if errors.Is(err, service.ErrInvalidOTP) {
+			return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "invalid one-time password",
+			})
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// EnrollTwoFactor starts a new enrollment. With 2FA enabled, code must hold a
+// current one-time password or recovery code.
+func (s *Server) EnrollTwoFactor(c *fiber.Ctx) error {
+	if ok, err := s.verifyCurrentOTP(c, "code"); !ok {
+		return err
+	}
+	key, err := s.twoFactorService.BeginEnroll()
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{
+		"uri":    key.URL(),
+		"secret": key.Secret(),
+	})
+}
+
+// ConfirmTwoFactor activates the pending secret once code matches it. With 2FA
+// enabled, current_code must also hold a code of the secret being replaced.
+func (s *Server) ConfirmTwoFactor(c *fiber.Ctx) error {
+	if ok, err := s.verifyCurrentOTP(c, "current_code"); !ok {
+		return err
+	}
+	codes, err := s.twoFactorService.ConfirmEnroll(c.FormValue("code"))
+	if err != nil {
+		if errors.Is(err, service.ErrTwoFactorNotPending) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "no pending enrollment",
+			})
+		}
+		if errors.Is(err, service.ErrInvalidOTP) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "invalid one-time password",
+			})
+		}
+		return err
+	}
+	s.recordAudit(c, service.AuditTwoFactorOn, 0, nil)
+	return c.JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+func (s *Server) DisableTwoFactor(c *fiber.Ctx) error {
+	enabled, err := s.twoFactorService.Enabled()
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return c.SendString("OK")
+	}
+	if ok, err := s.verifyCurrentOTP(c, "code"); !ok {
+		return err
+	}
+	if err := s.twoFactorService.Disable(); err != nil {
+		return err
+	}
+	s.recordAudit(c, service.AuditTwoFactorOff, 0, nil)
+	return c.SendString("OK")
+}
@@ -1,106 +1,191 @@
 package server
 
 import (
+	"encoding/json"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gofiber/websocket/v2"
 	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop/hub"
+	"github.com/zjyl1994/arkdrop/service"
 )
 
+// wsWriteTimeout bounds a single write, so a stalled peer can't hold its writer forever.
+const wsWriteTimeout = 10 * time.Second
+
 type Client struct {
-	conn    *websocket.Conn
-	channel string
+	conn     *websocket.Conn
+	channel  string
+	deviceID string
+	userName string
+	peerID   string
+
+	// send holds the frames the hub delivered until writeLoop writes them.
+	send *sendQueue[wsFrame]
+	// done is closed by close, stopped once writeLoop no longer uses conn.
+	done        chan struct{}
+	stopped     chan struct{}
+	closeOnce   sync.Once
+	closeCode   int
+	closeReason string
 }
 
-type ClientSetting struct {
-	Echo bool
+type wsFrame struct {
+	msgType int
+	data    []byte
 }
 
-var (
-	rooms          = make(map[string]map[*Client]bool)
-	roomsMutex     = &sync.Mutex{}
-	clientSettings = make(map[*Client]ClientSetting)
-)
-
-func WsHandler(c *websocket.Conn) {
-	channel := c.Query("channel")
-	if channel == "" {
-		channel = "default"
-	}
+func (s *Server) WsHandler(c *websocket.Conn) {
+	access := c.Locals("channel").(*channelAccess)
+	channel := access.channel
 	echo, _ := strconv.ParseBool(c.Query("echo"))
+	since, sinceErr := strconv.ParseInt(c.Query("since"), 10, 64)
+	resume := sinceErr == nil && since >= 0
 
 	client := &Client{
-		conn:    c,
-		channel: channel,
+		conn:     c,
+		channel:  channel,
+		deviceID: tokenDeviceID(c.Locals("user")),
+		userName: access.user,
+		peerID:   access.peer,
+		send:     newSendQueue[wsFrame](),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
 	}
+	go client.writeLoop()
+	// The connection is released once the handler returns, so wait for the writer.
+	defer func() {
+		client.close(0, "")
+		<-client.stopped
+	}()
 
-	addClientToRoom(client, ClientSetting{Echo: echo})
+	if err := s.joinRoom(client, ClientSetting{Echo: echo, Resume: resume}, since); err != nil {
+		logrus.Debugln("Websocket replay failed: ", err)
+		return
+	}
+	s.touchDevice(client.deviceID)
 
 	defer func() {
-		removeClientFromRoom(client)
-		_ = c.Close()
+		s.leaveRoom(client)
+		s.touchDevice(client.deviceID)
 	}()
 
 	logrus.Debugln("Websocket client join: ", channel)
 
 	for {
+		policy, err := s.loadChannelPolicy(channel)
+		if err != nil {
+			logrus.Errorln("Load channel policy failed: ", err)
+			client.close(websocket.CloseInternalServerErr, "")
+			break
+		}
+		// An oversized frame makes ReadMessage fail after answering with 1009 (message too big).
+		c.SetReadLimit(policy.maxMessageSize)
+
 		msgType, msg, err := c.ReadMessage()
 		if err != nil {
 			logrus.Debugln("Websocket link error or disconnect: ", err)
 			break
 		}
+		if wait := policy.limiter.allow(access.sender); wait > 0 {
+			client.close(websocket.ClosePolicyViolation, "message rate limit exceeded")
+			break
+		}
 
-		broadcastToRoom(client.channel, msgType, msg, client)
+		if signal, ok := parseSignal(msgType, msg); ok {
+			if err := s.relaySignal(client.channel, signal, client); err != nil {
+				client.close(websocket.CloseInvalidFramePayloadData, err.Error())
+				break
+			}
+			continue
+		}
+		if _, err := s.relayMessage(client.channel, msgType, msg, client, ""); err != nil {
+			client.close(websocket.CloseInvalidFramePayloadData, err.Error())
+			break
+		}
 	}
 }
 
-func addClientToRoom(client *Client, setting ClientSetting) {
-	roomsMutex.Lock()
-	defer roomsMutex.Unlock()
+func (client *Client) room() string {
+	return client.channel
+}
 
-	if _, exists := rooms[client.channel]; !exists {
-		rooms[client.channel] = make(map[*Client]bool)
-	}
-	rooms[client.channel][client] = true
-	clientSettings[client] = setting
+func (client *Client) device() string {
+	return client.deviceID
 }
 
-func removeClientFromRoom(client *Client) {
-	roomsMutex.Lock()
-	defer roomsMutex.Unlock()
+func (client *Client) user() string {
+	return client.userName
+}
+
+func (client *Client) peer() string {
+	return client.peerID
+}
+
+// close makes writeLoop send a close frame with code, unless code is 0, and
+// drop the connection. Frames still queued are discarded.
+func (client *Client) close(code int, reason string) {
+	client.closeOnce.Do(func() {
+		client.closeCode = code
+		client.closeReason = reason
+		close(client.done)
+	})
+}
 
-	if clients, exists := rooms[client.channel]; exists {
-		if _, found := clients[client]; found {
-			delete(clients, client)
-			if len(clients) == 0 {
-				delete(rooms, client.channel)
+// writeLoop writes the queued frames until close is called or a write fails.
+func (client *Client) writeLoop() {
+	defer close(client.stopped)
+	for {
+		select {
+		case <-client.done:
+			if client.closeCode != 0 {
+				_ = client.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(client.closeCode, client.closeReason), time.Now().Add(time.Second))
+			}
+			_ = client.conn.Close()
+			return
+		case <-client.send.ready:
+		}
+		for _, frame := range client.send.take() {
+			_ = client.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := client.conn.WriteMessage(frame.msgType, frame.data); err != nil {
+				logrus.Debugln("Websocket write failed: ", err)
+				// Closing the connection ends the read loop of WsHandler too.
+				_ = client.conn.Close()
+				return
 			}
 		}
-		delete(clientSettings, client)
 	}
 }
 
-func broadcastToRoom(channel string, msgType int, message []byte, sender *Client) {
-	roomsMutex.Lock()
-	defer roomsMutex.Unlock()
+// deliver queues event as-is, or wrapped in a hub.Envelope carrying its sequence number for resuming clients.
+func (client *Client) deliver(setting ClientSetting, event service.HubEvent) error {
+	if !setting.Resume {
+		return client.send.push(wsFrame{msgType: event.MsgType, data: event.Payload})
+	}
 
-	for client := range rooms[channel] {
-		var broadcastEcho bool
-		if settings, ok := clientSettings[client]; ok {
-			broadcastEcho = settings.Echo
-		}
+	envelope := hub.Envelope{
+		Seq:     event.Seq,
+		Channel: event.Channel,
+	}
+	if event.MsgType == websocket.BinaryMessage {
+		envelope.Binary = true
+		envelope.Payload = event.Payload
+	} else {
+		envelope.Data = string(event.Payload)
+	}
+	return client.pushEnvelope(envelope)
+}
 
-		// skip boardcast to sender when echo disabled.
-		if !broadcastEcho && client == sender {
-			continue
-		}
+func (client *Client) replayTruncated(seq int64) error {
+	return client.pushEnvelope(hub.Envelope{Seq: seq, Channel: client.channel, Truncated: true})
+}
 
-		if err := client.conn.WriteMessage(msgType, message); err != nil {
-			logrus.Errorln("Websocket send message failed: ", err)
-			_ = client.conn.Close()
-			delete(rooms[channel], client)
-			delete(clientSettings, client)
-		}
+func (client *Client) pushEnvelope(envelope hub.Envelope) error {
+	raw, err := json.Marshal(envelope)
+	if err != nil {
+		return err
 	}
+	return client.send.push(wsFrame{msgType: websocket.TextMessage, data: raw})
 }
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/fasthttp/websocket"
+	"github.com/zjyl1994/arkdrop/hub"
+	"github.com/zjyl1994/arkdrop/service"
+)
+
+// postEvent relays body to channel over POST /api/events and returns its sequence number.
+func (s *Server) postEvent(t *testing.T, token, query string, body []byte) int64 {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/events?"+query, bytes.NewReader(body))
+	req.Header.Set("Authorization", token)
+	resp := s.do(t, req)
+	expectStatus(t, resp, http.StatusOK)
+	var result struct {
+		Seq int64 `json:"seq"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result.Seq
+}
+
+// appendEvents stores count text events in channel, as if relayed while nobody listened.
+func (s *Server) appendEvents(t *testing.T, channel string, count int) int64 {
+	t.Helper()
+	var seq int64
+	for i := range count {
+		event := service.HubEvent{Channel: channel, MsgType: websocket.TextMessage, Payload: []byte(strconv.Itoa(i))}
+		if err := s.hubEventService.Append(&event); err != nil {
+			t.Fatal(err)
+		}
+		seq = event.Seq
+	}
+	return seq
+}
+
+func readEnvelope(t *testing.T, conn *websocket.Conn) hub.Envelope {
+	t.Helper()
+	_, raw, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope hub.Envelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		t.Fatalf("%s: %v", raw, err)
+	}
+	return envelope
+}
+
+func expectEnvelope(t *testing.T, conn *websocket.Conn, seq int64, data string) {
+	t.Helper()
+	if envelope := readEnvelope(t, conn); envelope.Seq != seq || envelope.Data != data || envelope.Truncated {
+		t.Fatalf("envelope = %+v, want seq %d with %q", envelope, seq, data)
+	}
+}
+
+func TestWebsocketReplay(t *testing.T) {
+	s := newTestServer(t, nil)
+	addr := s.serve(t)
+	phoneID, phone := s.registerTestDevice(t, "phone")
+	_, laptop := s.registerTestDevice(t, "laptop")
+
+	conn := dial(t, addr, "channel=default&since=0", phone)
+	waitFor(t, func() bool { return s.onlineDevices()[phoneID] > 0 })
+	first := s.postEvent(t, laptop, "channel=default", []byte("one"))
+	expectEnvelope(t, conn, first, "one")
+	_ = conn.Close()
+	waitFor(t, func() bool { return s.onlineDevices()[phoneID] == 0 })
+
+	// Sent while the phone was offline: its own message is not echoed back.
+	second := s.postEvent(t, laptop, "channel=default", []byte("two"))
+	s.postEvent(t, phone, "channel=default", []byte("mine"))
+	third := s.postEvent(t, laptop, "channel=default", []byte("three"))
+	s.postEvent(t, laptop, "channel=other", []byte("elsewhere"))
+
+	conn = dial(t, addr, "channel=default&since="+strconv.FormatInt(first, 10), phone)
+	expectEnvelope(t, conn, second, "two")
+	expectEnvelope(t, conn, third, "three")
+	live := s.postEvent(t, laptop, "channel=default", []byte("four"))
+	expectEnvelope(t, conn, live, "four")
+
+	// Clients that don't resume get bare messages.
+	plain := dial(t, addr, "channel=default", laptop)
+	waitFor(t, func() bool { return s.roomMembers()[defaultChannel] == 2 })
+	s.postEvent(t, phone, "channel=default", []byte("five"))
+	if _, raw, err := plain.ReadMessage(); err != nil || string(raw) != "five" {
+		t.Fatalf("plain client read %q, %v", raw, err)
+	}
+}
+
+func TestWebsocketReplayTruncated(t *testing.T) {
+	s := newTestServer(t, nil)
+	addr := s.serve(t)
+	_, phone := s.registerTestDevice(t, "phone")
+	last := s.appendEvents(t, defaultChannel, maxReplayEvents+2)
+
+	conn := dial(t, addr, "channel=default&since=0", phone)
+	var seq int64
+	for range maxReplayEvents {
+		seq = readEnvelope(t, conn).Seq
+	}
+	notice := readEnvelope(t, conn)
+	if !notice.Truncated || notice.Seq != seq {
+		t.Fatalf("after %d events got %+v, want the truncated notice at %d", maxReplayEvents, notice, seq)
+	}
+	_ = conn.Close()
+
+	// Resuming from the notice gets the rest, without another notice.
+	conn = dial(t, addr, "channel=default&since="+strconv.FormatInt(seq, 10), phone)
+	expectEnvelope(t, conn, last-1, strconv.Itoa(maxReplayEvents))
+	expectEnvelope(t, conn, last, strconv.Itoa(maxReplayEvents+1))
+	live := s.postEvent(t, s.testToken(t, "", adminUser), "channel=default", []byte("live"))
+	expectEnvelope(t, conn, live, "live")
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"bytes"
+	"html"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/zjyl1994/arkdrop/vars"
+	"github.com/zjyl1994/arkdrop/webui"
+)
+
+// initWebUI points the web UI at base_path. Its assets use relative URLs, so a
+// <base> element is all it needs to work on a sub-path.
+func (s *Server) initWebUI() error {
+	index, err := fs.ReadFile(webui.WebUI, "dist/index.html")
+	if err != nil {
+		return err
+	}
+	base := []byte(`<head><base href="` + html.EscapeString(s.cfg.BasePath+"/") + `">`)
+	s.indexHTML = bytes.Replace(index, []byte("<head>"), base, 1)
+	return nil
+}
+
+// WebUIIndex serves the entry page for every path the web UI routes itself.
+func (s *Server) WebUIIndex(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age="+strconv.Itoa(int(vars.JWT_TOKEN_EXPIRE.Seconds())))
+	c.Type("html")
+	return c.Status(fiber.StatusOK).Send(s.indexHTML)
+}
+
+// routePath is the request path without base_path, as the routes are declared.
+func (s *Server) routePath(c *fiber.Ctx) string {
+	path := strings.TrimPrefix(c.Path(), s.cfg.BasePath)
+	if path == "" {
+		return "/"
+	}
+	return path
+}
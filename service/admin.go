@@ -0,0 +1,150 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/zjyl1994/arkdrop/utils"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	settingAdminPasswordHash = "admin_password_hash"
+	settingJWTSecret         = "jwt_secret"
+	settingSetupToken        = "setup_token"
+
+	MinPasswordLength  = 8
+	goodPasswordLength = 12
+)
+
+var (
+	ErrSetupDone     = errors.New("admin password already set")
+	ErrShortPassword = errors.New("password is too short")
+)
+
+// commonPasswords are rejected outright by PasswordWeakness, compared case-insensitively.
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true, "passw0rd": true,
+	"12345678": true, "123456789": true, "1234567890": true, "11111111": true,
+	"qwerty123": true, "qwertyuiop": true, "iloveyou": true, "admin123": true,
+	"changeme": true, "letmein": true, "welcome1": true, "arkdrop": true,
+}
+
+// AdminService keeps the admin password hash and the JWT signing secret used
+// when no password is given through the environment.
+type AdminService struct{ *Store }
+
+// Configured reports whether the first-run setup has stored an admin password.
+func (s AdminService) Configured() (bool, error) {
+	hash, err := s.getSetting(settingAdminPasswordHash)
+	return hash != "", err
+}
+
+// Setup stores the first admin password. It fails with ErrSetupDone when one already exists.
+func (s AdminService) Setup(password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrShortPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Setting{}).Where("key = ?", settingAdminPasswordHash).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrSetupDone
+		}
+		if err := deleteSetting(tx, settingSetupToken); err != nil {
+			return err
+		}
+		return tx.Create(&Setting{Key: settingAdminPasswordHash, Value: string(hash)}).Error
+	})
+}
+
+// SetupToken returns the token that authorizes the first-run setup. The
+// first instance to ask stores it, so every instance accepts the same one.
+func (s AdminService) SetupToken() (string, error) {
+	err := s.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Setting{Key: settingSetupToken, Value: utils.SecureRandString(32)}).Error
+	if err != nil {
+		return "", err
+	}
+	return s.getSetting(settingSetupToken)
+}
+
+func (s AdminService) VerifyPassword(password string) (bool, error) {
+	hash, err := s.getSetting(settingAdminPasswordHash)
+	if err != nil || hash == "" {
+		return false, err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SigningSecret returns the persisted JWT key, generating it on first use.
+func (s AdminService) SigningSecret() ([]byte, error) {
+	secret, err := s.getSetting(settingJWTSecret)
+	if err != nil {
+		return nil, err
+	}
+	if secret != "" {
+		return hex.DecodeString(secret)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := setSetting(s.DB, settingJWTSecret, hex.EncodeToString(key)); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// PasswordWeakness explains why password is weak, or returns an empty string.
+func PasswordWeakness(password string) string {
+	if len(password) < MinPasswordLength {
+		return "it is shorter than 8 characters"
+	}
+	if commonPasswords[strings.ToLower(password)] {
+		return "it is a commonly used password"
+	}
+	if len(password) >= goodPasswordLength {
+		return ""
+	}
+
+	var classes [4]bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			classes[0] = true
+		case unicode.IsUpper(r):
+			classes[1] = true
+		case unicode.IsDigit(r):
+			classes[2] = true
+		default:
+			classes[3] = true
+		}
+	}
+	count := 0
+	for _, ok := range classes {
+		if ok {
+			count++
+		}
+	}
+	if count < 3 {
+		return "it is shorter than 12 characters and mixes fewer than three character classes"
+	}
+	return ""
+}
@@ -3,11 +3,9 @@ package service
 import (
 	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/zjyl1994/arkdrop/utils"
-	"github.com/zjyl1994/arkdrop/vars"
 	"gorm.io/gorm"
 )
 
@@ -16,17 +14,17 @@ const (
 	attachmentShareTokenMaxAttempts = 8
 )
 
-func createAttachmentShare(attachmentID int, expiresAt int64) (AttachmentShare, error) {
+func (s ParcelService) createAttachmentShare(attachmentID int, expiresAt int64) (AttachmentShare, error) {
 	share := AttachmentShare{
 		AttachmentID: attachmentID,
 		ExpiresAt:    expiresAt,
 	}
 
 	for attempt := 0; attempt < attachmentShareTokenMaxAttempts; attempt++ {
-		token := utils.RandString(attachmentShareTokenLength)
+		token := utils.SecureRandString(attachmentShareTokenLength)
 
 		var existing AttachmentShare
-		err := vars.DB.Select("token").First(&existing, "token = ?", token).Error
+		err := s.DB.Select("token").First(&existing, "token = ?", token).Error
 		if err == nil {
 			continue
 		}
@@ -35,9 +33,10 @@ func createAttachmentShare(attachmentID int, expiresAt int64) (AttachmentShare,
 		}
 
 		share.Token = token
-		if err := vars.DB.Create(&share).Error; err == nil {
+		if err := s.DB.Create(&share).Error; err == nil {
+			s.Metrics.ShareLinksCreated.Inc()
 			return share, nil
-		} else if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		} else if errors.Is(err, gorm.ErrDuplicatedKey) {
 			continue
 		} else {
 			return AttachmentShare{}, err
@@ -47,19 +46,19 @@ func createAttachmentShare(attachmentID int, expiresAt int64) (AttachmentShare,
 	return AttachmentShare{}, fmt.Errorf("failed to create unique attachment share token")
 }
 
-func (ParcelService) GetOrCreateAttachmentShare(attachmentID int, expiresAt int64) (AttachmentShare, error) {
+func (s ParcelService) GetOrCreateAttachmentShare(attachmentID int, expiresAt int64) (AttachmentShare, error) {
 	now := time.Now().Unix()
 
-	if err := vars.DB.Where("attachment_id = ? AND expires_at <= ?", attachmentID, now).Delete(&AttachmentShare{}).Error; err != nil {
+	if err := s.DB.Where("attachment_id = ? AND expires_at <= ?", attachmentID, now).Delete(&AttachmentShare{}).Error; err != nil {
 		return AttachmentShare{}, err
 	}
 
 	var share AttachmentShare
-	err := vars.DB.Where("attachment_id = ? AND expires_at > ?", attachmentID, now).Order("expires_at DESC").First(&share).Error
+	err := s.DB.Where("attachment_id = ? AND expires_at > ?", attachmentID, now).Order("expires_at DESC").First(&share).Error
 	if err == nil {
 		if expiresAt != share.ExpiresAt {
 			share.ExpiresAt = expiresAt
-			if updateErr := vars.DB.Model(&share).Update("expires_at", expiresAt).Error; updateErr != nil {
+			if updateErr := s.DB.Model(&share).Update("expires_at", expiresAt).Error; updateErr != nil {
 				return AttachmentShare{}, updateErr
 			}
 		}
@@ -69,9 +68,9 @@ func (ParcelService) GetOrCreateAttachmentShare(attachmentID int, expiresAt int6
 		return AttachmentShare{}, err
 	}
 
-	return createAttachmentShare(attachmentID, expiresAt)
+	return s.createAttachmentShare(attachmentID, expiresAt)
 }
 
-func (ParcelService) CleanExpiredAttachmentShares() error {
-	return vars.DB.Where("expires_at <= ?", time.Now().Unix()).Delete(&AttachmentShare{}).Error
+func (s ParcelService) CleanExpiredAttachmentShares() error {
+	return s.DB.Where("expires_at <= ?", time.Now().Unix()).Delete(&AttachmentShare{}).Error
 }
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AuditLoginSuccess   = "login.success"
+	AuditLoginFailure   = "login.failure"
+	AuditParcelCreate   = "parcel.create"
+	AuditAttachmentAdd  = "parcel.attachment_add"
+	AuditParcelDelete   = "parcel.delete"
+	AuditParcelClean    = "parcel.clean"
+	AuditParcelFavorite = "parcel.favorite"
+	AuditParcelExpire   = "parcel.expire"
+	AuditShareCreate    = "share.create"
+	AuditShareDownload  = "share.download"
+	AuditTwoFactorOn    = "2fa.enable"
+	AuditTwoFactorOff   = "2fa.disable"
+	AuditPasskeyAdd     = "passkey.add"
+	AuditPasskeyDelete  = "passkey.delete"
+	AuditPairingCreate  = "pairing.create"
+	AuditDeviceRegister = "device.register"
+	AuditDeviceDelete   = "device.delete"
+	AuditChannelSave    = "channel.save"
+	AuditChannelDelete  = "channel.delete"
+	AuditDirectTransfer = "transfer.direct"
+	AuditSetupComplete  = "setup.complete"
+	AuditSettingsUpdate = "settings.update"
+)
+
+const auditExportBatchSize = 500
+
+type AuditFilter struct {
+	Types []string
+	Since int64
+	Until int64
+	Limit int
+}
+
+type AuditService struct{ *Store }
+
+func (s AuditService) Record(event AuditEvent, detail map[string]any) error {
+	if len(detail) > 0 {
+		raw, err := json.Marshal(detail)
+		if err != nil {
+			return err
+		}
+		event.Detail = string(raw)
+	}
+	return s.DB.Create(&event).Error
+}
+
+func (f AuditFilter) apply(query *gorm.DB) *gorm.DB {
+	if len(f.Types) > 0 {
+		query = query.Where("type IN ?", f.Types)
+	}
+	if f.Since > 0 {
+		query = query.Where("created_at >= ?", f.Since)
+	}
+	if f.Until > 0 {
+		query = query.Where("created_at <= ?", f.Until)
+	}
+	return query
+}
+
+func (s AuditService) Query(filter AuditFilter) ([]AuditEvent, error) {
+	var events []AuditEvent
+	query := filter.apply(s.DB.Model(&AuditEvent{}))
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	err := query.Order("id DESC").Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Export walks every matching event in insertion order and hands them to fn in batches.
+func (s AuditService) Export(filter AuditFilter, fn func([]AuditEvent) error) error {
+	var batch []AuditEvent
+	return filter.apply(s.DB.Model(&AuditEvent{})).FindInBatches(&batch, auditExportBatchSize, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
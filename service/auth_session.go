@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuthSessionService keeps the state of multi-step logins and CAP challenges
+// in the database, so a flow started on one instance can finish on another.
+type AuthSessionService struct{ *Store }
+
+// Get returns the unexpired data stored under key, or an empty string.
+func (s AuthSessionService) Get(key string) (string, error) {
+	var session AuthSession
+	err := s.DB.Where("key = ? AND (expires_at = 0 OR expires_at > ?)", key, time.Now().Unix()).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return session.Data, err
+}
+
+// Set stores data under key until expire, or for good when expire is zero.
+func (s AuthSessionService) Set(key, data string, expire time.Time) error {
+	session := AuthSession{Key: key, Data: data}
+	if !expire.IsZero() {
+		session.ExpiresAt = expire.Unix()
+	}
+	return s.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"data", "expires_at"}),
+	}).Create(&session).Error
+}
+
+func (s AuthSessionService) Del(key string) error {
+	return s.DB.Delete(&AuthSession{}, "key = ?", key).Error
+}
+
+func (s AuthSessionService) CleanExpired() error {
+	return s.DB.Where("expires_at > 0 AND expires_at <= ?", time.Now().Unix()).Delete(&AuthSession{}).Error
+}
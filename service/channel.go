@@ -0,0 +1,92 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/zjyl1994/arkdrop/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidChannelName = errors.New("invalid channel name")
+
+	channelNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,64}$`)
+)
+
+type ChannelService struct{ *Store }
+
+func ValidChannelName(name string) bool {
+	return channelNamePattern.MatchString(name)
+}
+
+// Devices returns the device IDs allowed to join.
+func (c Channel) Devices() []string {
+	return utils.SplitList(c.AllowedDevices)
+}
+
+// Users returns the users allowed to join, whatever device they are on.
+func (c Channel) Users() []string {
+	return utils.SplitList(c.AllowedUsers)
+}
+
+// Allows reports whether a client may join. Any authenticated client may
+// when the channel lists neither devices nor users.
+func (c Channel) Allows(deviceID, user string) bool {
+	devices, users := c.Devices(), c.Users()
+	if len(devices) == 0 && len(users) == 0 {
+		return true
+	}
+	return (deviceID != "" && slices.Contains(devices, deviceID)) ||
+		(user != "" && slices.Contains(users, user))
+}
+
+func (s ChannelService) Get(name string) (Channel, error) {
+	var channel Channel
+	err := s.DB.First(&channel, "name = ?", name).Error
+	return channel, err
+}
+
+func (s ChannelService) List() ([]Channel, error) {
+	var channels []Channel
+	err := s.DB.Order("name ASC").Find(&channels).Error
+	if err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+func (s ChannelService) Save(name string, devices, users []string, maxMessageSize int64, rateLimit int) (Channel, error) {
+	if !ValidChannelName(name) {
+		return Channel{}, ErrInvalidChannelName
+	}
+	channel := Channel{
+		Name:           name,
+		AllowedDevices: strings.Join(devices, ","),
+		AllowedUsers:   strings.Join(users, ","),
+		MaxMessageSize: maxMessageSize,
+		RateLimit:      rateLimit,
+	}
+	err := s.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "allowed_devices", "allowed_users", "max_message_size", "rate_limit"}),
+	}).Create(&channel).Error
+	if err != nil {
+		return Channel{}, err
+	}
+	return s.Get(name)
+}
+
+func (s ChannelService) Delete(name string) error {
+	result := s.DB.Delete(&Channel{}, "name = ?", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
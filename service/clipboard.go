@@ -0,0 +1,91 @@
+package service
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zjyl1994/arkdrop/hub"
+	"github.com/zjyl1994/arkdrop/utils"
+	"gorm.io/gorm/clause"
+)
+
+type ClipboardService struct{ *Store }
+
+func (s ClipboardService) Latest(channel string) (ClipboardEntry, error) {
+	var entry ClipboardEntry
+	err := s.DB.First(&entry, "channel = ?", channel).Error
+	return entry, err
+}
+
+// Save stores message as the latest entry of channel unless a newer one already is.
+func (s ClipboardService) Save(channel string, seq int64, message []byte) error {
+	return s.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "channel"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "seq", "message"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "excluded.seq > clipboard_entries.seq"},
+		}},
+	}).Create(&ClipboardEntry{Channel: channel, Seq: seq, Message: string(message)}).Error
+}
+
+// SaveAsParcel records a clipboard entry as a regular parcel, images as an attachment.
+func (s ClipboardService) SaveAsParcel(clip hub.ClipboardMessage) (Parcel, error) {
+	now := time.Now().Unix()
+	parcel := Parcel{
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		SourceDeviceID: clip.SourceDevice,
+	}
+	if clip.Kind != hub.ClipboardImage {
+		parcel.Content = clip.Data
+		return ParcelService{s.Store}.Create(parcel)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(clip.Data)
+	if err != nil {
+		return Parcel{}, hub.ErrInvalidClipboard
+	}
+	ext := clipboardImageExt(clip.MIME)
+	diskFileName := utils.RandString(10) + ext
+	diskPath := filepath.Join(s.DataDir, "files", diskFileName)
+	if err := os.WriteFile(diskPath, data, 0644); err != nil {
+		return Parcel{}, err
+	}
+
+	parcel, err = ParcelService{s.Store}.Create(parcel)
+	if err != nil {
+		_ = os.Remove(diskPath)
+		return Parcel{}, err
+	}
+	err = ParcelService{s.Store}.AddAttachments(parcel.ID, []Attachment{{
+		ContentType: clip.MIME,
+		FileSize:    int64(len(data)),
+		FileName:    "clipboard-" + time.Unix(clip.CreatedAt, 0).Format("20060102-150405") + ext,
+		FilePath:    diskFileName,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}})
+	if err != nil {
+		_ = ParcelService{s.Store}.Delete(parcel.ID)
+		_ = os.Remove(diskPath)
+		return Parcel{}, err
+	}
+	return parcel, nil
+}
+
+func clipboardImageExt(mimeType string) string {
+	subtype := strings.TrimPrefix(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]), "image/")
+	switch subtype {
+	case "jpeg":
+		return ".jpg"
+	case "svg+xml":
+		return ".svg"
+	case "png", "gif", "webp", "bmp", "tiff", "avif":
+		return "." + subtype
+	default:
+		return ".bin"
+	}
+}
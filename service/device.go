@@ -0,0 +1,76 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/zjyl1994/arkdrop/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	deviceIDLength      = 16
+	deviceNameMaxLength = 64
+)
+
+type DeviceService struct{ *Store }
+
+func normalizeDeviceName(name string) string {
+	name = strings.TrimSpace(name)
+	if len([]rune(name)) > deviceNameMaxLength {
+		name = string([]rune(name)[:deviceNameMaxLength])
+	}
+	return name
+}
+
+func (s DeviceService) Register(name string) (Device, error) {
+	device := Device{
+		// Channel ACLs and peer bindings trust the ID, so it must not be guessable.
+		ID:         utils.SecureRandString(deviceIDLength),
+		Name:       normalizeDeviceName(name),
+		LastSeenAt: time.Now().Unix(),
+	}
+	err := s.DB.Create(&device).Error
+	return device, err
+}
+
+func (s DeviceService) Get(id string) (Device, error) {
+	var device Device
+	err := s.DB.First(&device, "id = ?", id).Error
+	return device, err
+}
+
+func (s DeviceService) List() ([]Device, error) {
+	var devices []Device
+	err := s.DB.Order("name ASC").Find(&devices).Error
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (s DeviceService) Rename(id, name string) error {
+	result := s.DB.Model(&Device{}).Where("id = ?", id).Update("name", normalizeDeviceName(name))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s DeviceService) Touch(id string) error {
+	return s.DB.Model(&Device{}).Where("id = ?", id).Update("last_seen_at", time.Now().Unix()).Error
+}
+
+func (s DeviceService) Delete(id string) error {
+	result := s.DB.Delete(&Device{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type HubEventService struct{ *Store }
+
+// Append persists a relayed message and fills in its sequence number.
+//
+// Clients resume after the last sequence number they saw, so events must
+// become visible in sequence order. PostgreSQL hands out sequence numbers
+// before commit, so instances take turns there: a transaction lock makes each
+// insert wait until the previous one committed. SQLite serializes writes anyway.
+func (s HubEventService) Append(event *HubEvent) error {
+	if s.DB.Dialector.Name() != "postgres" {
+		return s.DB.Create(event).Error
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('arkdrop:hub_events'))").Error; err != nil {
+			return err
+		}
+		return tx.Create(event).Error
+	})
+}
+
+func (s HubEventService) Get(seq int64) (HubEvent, error) {
+	var event HubEvent
+	err := s.DB.First(&event, "seq = ?", seq).Error
+	return event, err
+}
+
+// Since returns up to limit events after seq that a client in channel, acting
+// as deviceID, would have received while connected.
+func (s HubEventService) Since(seq int64, channel, deviceID string, limit int) ([]HubEvent, error) {
+	var events []HubEvent
+	query := s.DB.Where("seq > ?", seq)
+	if deviceID == "" {
+		query = query.Where("channel = ? AND target_device_id = ''", channel)
+	} else {
+		query = query.Where("(channel = ? AND target_device_id = '') OR target_device_id = ?", channel, deviceID)
+	}
+	err := query.Order("seq ASC").Limit(limit).Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (s HubEventService) CleanExpired() error {
+	return s.DB.Where("created_at < ?", time.Now().Add(-s.EventRetention).Unix()).Delete(&HubEvent{}).Error
+}
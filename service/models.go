@@ -1,12 +1,15 @@
 package service
 
 type Parcel struct {
-	ID          int          `gorm:"primarykey" json:"id"`
-	CreatedAt   int64        `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt   int64        `gorm:"autoUpdateTime" json:"updated_at"`
-	Favorite    bool         `json:"favorite"`
-	Content     string       `json:"content"`
-	Attachments []Attachment `json:"attachments"`
+	ID             int          `gorm:"primarykey" json:"id"`
+	CreatedAt      int64        `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      int64        `gorm:"autoUpdateTime" json:"updated_at"`
+	Favorite       bool         `json:"favorite"`
+	Content        string       `json:"content"`
+	SourceDeviceID string       `gorm:"size:32;not null;default:''" json:"source_device_id,omitempty"`
+	TargetDeviceID string       `gorm:"size:32;not null;default:'';index" json:"target_device_id,omitempty"`
+	TransferID     string       `gorm:"size:32;not null;default:'';index:,unique,where:transfer_id <> ''" json:"transfer_id,omitempty"`
+	Attachments    []Attachment `json:"attachments"`
 }
 
 type Attachment struct {
@@ -27,3 +30,99 @@ type AttachmentShare struct {
 	AttachmentID int    `gorm:"index" json:"attachment_id"`
 	ExpiresAt    int64  `gorm:"index" json:"expires_at"`
 }
+
+type ParcelStats struct {
+	Parcels         int64
+	FavoriteParcels int64
+	Attachments     int64
+	StorageBytes    int64
+}
+
+type AuditEvent struct {
+	ID        int    `gorm:"primarykey" json:"id"`
+	CreatedAt int64  `gorm:"autoCreateTime;index" json:"created_at"`
+	Type      string `gorm:"size:32;index" json:"type"`
+	TargetID  int    `json:"target_id,omitempty"`
+	DeviceID  string `gorm:"size:32;not null;default:''" json:"device_id,omitempty"`
+	RemoteIP  string `gorm:"size:64" json:"remote_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+type Setting struct {
+	Key       string `gorm:"primarykey;size:64" json:"key"`
+	UpdatedAt int64  `gorm:"autoUpdateTime" json:"updated_at"`
+	Value     string `json:"value"`
+}
+
+type RecoveryCode struct {
+	ID        int    `gorm:"primarykey" json:"id"`
+	CreatedAt int64  `gorm:"autoCreateTime" json:"created_at"`
+	CodeHash  string `gorm:"size:64;uniqueIndex" json:"-"`
+	UsedAt    int64  `json:"used_at"`
+}
+
+type Passkey struct {
+	ID           int    `gorm:"primarykey" json:"id"`
+	CreatedAt    int64  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    int64  `gorm:"autoUpdateTime" json:"updated_at"`
+	Name         string `json:"name"`
+	CredentialID string `gorm:"size:255;uniqueIndex" json:"credential_id"`
+	Credential   string `json:"-"`
+	LastUsedAt   int64  `json:"last_used_at"`
+}
+
+type PairingCode struct {
+	ID        int    `gorm:"primarykey" json:"id"`
+	CreatedAt int64  `gorm:"autoCreateTime" json:"created_at"`
+	Code      string `gorm:"size:6;index" json:"code"`
+	Token     string `gorm:"size:32;uniqueIndex" json:"-"`
+	ExpiresAt int64  `gorm:"index" json:"expires_at"`
+	UsedAt    int64  `json:"used_at"`
+	UsedBy    string `gorm:"size:64" json:"used_by"`
+}
+
+type Device struct {
+	ID         string `gorm:"primarykey;size:32" json:"id"`
+	CreatedAt  int64  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  int64  `gorm:"autoUpdateTime" json:"updated_at"`
+	Name       string `json:"name"`
+	LastSeenAt int64  `json:"last_seen_at"`
+}
+
+type HubEvent struct {
+	Seq            int64  `gorm:"primarykey;autoIncrement" json:"seq"`
+	CreatedAt      int64  `gorm:"autoCreateTime;index" json:"created_at"`
+	Channel        string `gorm:"size:64;index" json:"channel"`
+	SourceDeviceID string `gorm:"size:32" json:"source_device_id,omitempty"`
+	TargetDeviceID string `gorm:"size:32;index" json:"target_device_id,omitempty"`
+	MsgType        int    `json:"msg_type"`
+	Payload        []byte `json:"payload"`
+}
+
+// Channel declares a hub channel with its own access list and limits.
+// Zero limits fall back to the server wide defaults.
+type Channel struct {
+	Name           string `gorm:"primarykey;size:64" json:"name"`
+	CreatedAt      int64  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      int64  `gorm:"autoUpdateTime" json:"updated_at"`
+	AllowedDevices string `gorm:"not null;default:''" json:"-"`
+	AllowedUsers   string `gorm:"not null;default:''" json:"-"`
+	MaxMessageSize int64  `json:"max_message_size"`
+	RateLimit      int    `json:"rate_limit"`
+}
+
+// ClipboardEntry keeps the latest clipboard message relayed on a channel.
+type ClipboardEntry struct {
+	Channel   string `gorm:"primarykey;size:64" json:"channel"`
+	UpdatedAt int64  `gorm:"autoUpdateTime" json:"updated_at"`
+	Seq       int64  `json:"seq"`
+	Message   string `json:"message"`
+}
+
+// AuthSession holds the state of a login flow between its steps.
+type AuthSession struct {
+	Key       string `gorm:"primarykey" json:"key"`
+	Data      string `json:"data"`
+	ExpiresAt int64  `gorm:"index" json:"expires_at"`
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zjyl1994/arkdrop/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	pairingTokenLength     = 32
+	pairingCodeMaxAttempts = 8
+	PairingCodeExpire      = 5 * time.Minute
+)
+
+var ErrInvalidPairingCode = errors.New("invalid or expired pairing code")
+
+type PairingService struct{ *Store }
+
+// Create mints a single-use pairing code. The six digit code is unique among unexpired codes.
+func (s PairingService) Create() (PairingCode, error) {
+	now := time.Now()
+	pairing := PairingCode{
+		Token:     utils.SecureRandString(pairingTokenLength),
+		ExpiresAt: now.Add(PairingCodeExpire).Unix(),
+	}
+
+	for attempt := 0; attempt < pairingCodeMaxAttempts; attempt++ {
+		code := fmt.Sprintf("%06d", utils.SecureRandIntN(1000000))
+
+		var count int64
+		err := s.DB.Model(&PairingCode{}).Where("code = ? AND used_at = 0 AND expires_at > ?", code, now.Unix()).Count(&count).Error
+		if err != nil {
+			return PairingCode{}, err
+		}
+		if count > 0 {
+			continue
+		}
+
+		pairing.Code = code
+		if err := s.DB.Create(&pairing).Error; err != nil {
+			return PairingCode{}, err
+		}
+		return pairing, nil
+	}
+
+	return PairingCode{}, fmt.Errorf("failed to create unique pairing code")
+}
+
+// Redeem consumes an unexpired pairing code, matched either by its six digit code or its QR token.
+func (s PairingService) Redeem(code, token, usedBy string) (PairingCode, error) {
+	if code == "" && token == "" {
+		return PairingCode{}, ErrInvalidPairingCode
+	}
+
+	now := time.Now().Unix()
+	var pairing PairingCode
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("used_at = 0 AND expires_at > ?", now)
+		if token != "" {
+			query = query.Where("token = ?", token)
+		} else {
+			query = query.Where("code = ?", code)
+		}
+		if err := query.First(&pairing).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidPairingCode
+			}
+			return err
+		}
+
+		result := tx.Model(&PairingCode{}).Where("id = ? AND used_at = 0", pairing.ID).Updates(map[string]any{
+			"used_at": now,
+			"used_by": usedBy,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidPairingCode
+		}
+		pairing.UsedAt = now
+		pairing.UsedBy = usedBy
+		return nil
+	})
+	if err != nil {
+		return PairingCode{}, err
+	}
+	return pairing, nil
+}
+
+func (s PairingService) CleanExpired() error {
+	return s.DB.Where("expires_at <= ?", time.Now().Unix()).Delete(&PairingCode{}).Error
+}
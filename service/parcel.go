@@ -1,29 +1,50 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/sirupsen/logrus"
-	"github.com/zjyl1994/arkdrop/vars"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type ParcelService struct{}
+type ParcelService struct{ *Store }
 
-func (ParcelService) Create(parcel Parcel) (Parcel, error) {
-	err := vars.DB.Create(&parcel).Error
+func (s ParcelService) Create(parcel Parcel) (Parcel, error) {
+	err := s.DB.Create(&parcel).Error
 	return parcel, err
 }
 
-func (ParcelService) AddAttachments(parcelID int, attachments []Attachment) error {
+// RecordTransfer stores the metadata-only parcel of a direct transfer once;
+// a second report of the same transfer returns the existing parcel. The
+// unique index on transfer_id settles reports that arrive at the same time.
+func (s ParcelService) RecordTransfer(parcel Parcel) (Parcel, bool, error) {
+	result := s.DB.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "transfer_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "transfer_id <> ''"}}},
+		DoNothing:   true,
+	}).Create(&parcel)
+	if result.Error != nil {
+		return Parcel{}, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return parcel, true, nil
+	}
+	var existing Parcel
+	err := s.DB.Where("transfer_id = ?", parcel.TransferID).First(&existing).Error
+	return existing, false, err
+}
+
+func (s ParcelService) AddAttachments(parcelID int, attachments []Attachment) error {
 	if len(attachments) == 0 {
 		return nil
 	}
 
-	return vars.DB.Transaction(func(tx *gorm.DB) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
 		var parcel Parcel
 		if err := tx.First(&parcel, parcelID).Error; err != nil {
 			return err
@@ -41,9 +62,9 @@ func (ParcelService) AddAttachments(parcelID int, attachments []Attachment) erro
 	})
 }
 
-func (ParcelService) Delete(id int) error {
+func (s ParcelService) Delete(id int) error {
 	var fileList []Attachment
-	err := vars.DB.Where("parcel_id = ?", id).Find(&fileList).Error
+	err := s.DB.Where("parcel_id = ?", id).Find(&fileList).Error
 	if err != nil {
 		return err
 	}
@@ -51,20 +72,20 @@ func (ParcelService) Delete(id int) error {
 	attachmentPaths := make([]string, 0, len(fileList))
 	for _, file := range fileList {
 		attachmentIDs = append(attachmentIDs, file.ID)
-		attachmentPaths = append(attachmentPaths, filepath.Join(vars.DataDir, "files", file.FilePath))
+		attachmentPaths = append(attachmentPaths, filepath.Join(s.DataDir, "files", file.FilePath))
 	}
 
-	err = vars.DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Delete(&Parcel{}, id).Error
-		if err != nil {
-			return err
-		}
+	// Children go first, as PostgreSQL enforces the attachment foreign key.
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
 		if len(attachmentIDs) > 0 {
 			if err := tx.Where("attachment_id IN ?", attachmentIDs).Delete(&AttachmentShare{}).Error; err != nil {
 				return err
 			}
 		}
-		return tx.Where("parcel_id = ?", id).Delete(&Attachment{}).Error
+		if err := tx.Where("parcel_id = ?", id).Delete(&Attachment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Parcel{}, id).Error
 	})
 	if err != nil {
 		return err
@@ -79,28 +100,37 @@ func (ParcelService) Delete(id int) error {
 	return nil
 }
 
-func (s ParcelService) Clean(favorite bool) error {
+func (s ParcelService) Clean(favorite bool) ([]int, error) {
 	var parcels []Parcel
-	err := vars.DB.Select("id").Where("favorite = ?", favorite).Find(&parcels).Error
+	err := s.DB.Select("id").Where("favorite = ?", favorite).Find(&parcels).Error
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	deletedIDs := make([]int, 0, len(parcels))
 	for _, parcel := range parcels {
 		if err := s.Delete(parcel.ID); err != nil {
-			return err
+			return deletedIDs, err
 		}
+		deletedIDs = append(deletedIDs, parcel.ID)
 	}
 
-	return nil
+	return deletedIDs, nil
 }
 
-func (ParcelService) List(favorite *bool) ([]Parcel, error) {
+// List returns parcels visible to deviceID: broadcast parcels plus the ones
+// addressed to or sent by that device. An empty deviceID only sees broadcasts.
+func (s ParcelService) List(favorite *bool, deviceID string) ([]Parcel, error) {
 	var parcels []Parcel
-	query := vars.DB.Preload("Attachments")
+	query := s.DB.Preload("Attachments")
 	if favorite != nil {
 		query = query.Where("favorite = ?", *favorite)
 	}
+	if deviceID == "" {
+		query = query.Where("target_device_id = ''")
+	} else {
+		query = query.Where("target_device_id = '' OR target_device_id = ? OR source_device_id = ?", deviceID, deviceID)
+	}
 
 	err := query.Order("created_at DESC").Find(&parcels).Error
 	if err != nil {
@@ -109,24 +139,62 @@ func (ParcelService) List(favorite *bool) ([]Parcel, error) {
 	return parcels, nil
 }
 
-func (ParcelService) Favorite(id int) error {
-	return vars.DB.Model(&Parcel{}).Where("id = ?", id).Updates(map[string]interface{}{
+func (s ParcelService) Favorite(id int) error {
+	return s.DB.Model(&Parcel{}).Where("id = ?", id).Updates(map[string]interface{}{
 		"favorite":   gorm.Expr("NOT favorite"),
 		"updated_at": time.Now().Unix(),
 	}).Error
 }
 
-func (s ParcelService) CleanExpired() error {
+func (s ParcelService) Stats() (ParcelStats, error) {
+	var stats ParcelStats
+	if err := s.DB.Model(&Parcel{}).Count(&stats.Parcels).Error; err != nil {
+		return ParcelStats{}, err
+	}
+	if err := s.DB.Model(&Parcel{}).Where("favorite = ?", true).Count(&stats.FavoriteParcels).Error; err != nil {
+		return ParcelStats{}, err
+	}
+	err := s.DB.Model(&Attachment{}).Select("COUNT(*) AS attachments, CAST(COALESCE(SUM(file_size), 0) AS BIGINT) AS storage_bytes").Scan(&stats).Error
+	if err != nil {
+		return ParcelStats{}, err
+	}
+	return stats, nil
+}
+
+// CleanExpired deletes expired parcels one by one and stops early, between two parcels, when ctx is cancelled.
+func (s ParcelService) CleanExpired(ctx context.Context) error {
+	start := time.Now()
+	defer func() {
+		s.Metrics.CleanupDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	var expiredParcels []Parcel
-	err := vars.DB.Where("favorite = ?", false).Where("created_at < ?", time.Now().Add(-vars.AutoExpire).Unix()).Find(&expiredParcels).Error
+	err := s.DB.Where("favorite = ?", false).Where("created_at < ?", time.Now().Add(-s.CurrentSettings().AutoExpire).Unix()).Find(&expiredParcels).Error
 	if err != nil {
 		return err
 	}
+	deletedIDs := make([]int, 0, len(expiredParcels))
+	defer func() {
+		s.Metrics.CleanupDeleted.Add(float64(len(deletedIDs)))
+		s.Metrics.CleanupLastDeleted.Set(float64(len(deletedIDs)))
+		if len(deletedIDs) > 0 {
+			auditErr := AuditService{s.Store}.Record(AuditEvent{Type: AuditParcelExpire}, map[string]any{
+				"parcel_ids": deletedIDs,
+			})
+			if auditErr != nil {
+				logrus.Errorln("Record audit event failed:", auditErr)
+			}
+		}
+	}()
 	for _, parcel := range expiredParcels {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		err := s.Delete(parcel.ID)
 		if err != nil {
 			return err
 		}
+		deletedIDs = append(deletedIDs, parcel.ID)
 	}
 	return nil
 }
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+)
+
+const (
+	settingWebAuthnUserID = "webauthn_user_id"
+	webAuthnUserName      = "arkdrop"
+)
+
+// PasskeyUser is the single shared ArkDrop account as seen by WebAuthn.
+type PasskeyUser struct {
+	id          []byte
+	credentials []webauthn.Credential
+}
+
+func (u *PasskeyUser) WebAuthnID() []byte                         { return u.id }
+func (u *PasskeyUser) WebAuthnName() string                       { return webAuthnUserName }
+func (u *PasskeyUser) WebAuthnDisplayName() string                { return "ArkDrop" }
+func (u *PasskeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+type PasskeyService struct{ *Store }
+
+func encodeCredentialID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+func (s PasskeyService) userID() ([]byte, error) {
+	rawID, err := s.getSetting(settingWebAuthnUserID)
+	if err != nil {
+		return nil, err
+	}
+	if rawID != "" {
+		return base64.RawURLEncoding.DecodeString(rawID)
+	}
+
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	if err := setSetting(s.DB, settingWebAuthnUserID, base64.RawURLEncoding.EncodeToString(id)); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// User loads the shared account together with every registered credential.
+func (s PasskeyService) User() (*PasskeyUser, error) {
+	id, err := s.userID()
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	user := &PasskeyUser{id: id, credentials: make([]webauthn.Credential, 0, len(passkeys))}
+	for _, passkey := range passkeys {
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(passkey.Credential), &credential); err != nil {
+			return nil, err
+		}
+		user.credentials = append(user.credentials, credential)
+	}
+	return user, nil
+}
+
+func (s PasskeyService) List() ([]Passkey, error) {
+	var passkeys []Passkey
+	err := s.DB.Order("created_at DESC").Find(&passkeys).Error
+	if err != nil {
+		return nil, err
+	}
+	return passkeys, nil
+}
+
+func (s PasskeyService) Add(name string, credential *webauthn.Credential) (Passkey, error) {
+	raw, err := json.Marshal(credential)
+	if err != nil {
+		return Passkey{}, err
+	}
+	passkey := Passkey{
+		Name:         name,
+		CredentialID: encodeCredentialID(credential.ID),
+		Credential:   string(raw),
+	}
+	err = s.DB.Create(&passkey).Error
+	return passkey, err
+}
+
+// Touch stores the updated authenticator state (sign count, flags) after a successful login.
+func (s PasskeyService) Touch(credential *webauthn.Credential) (Passkey, error) {
+	raw, err := json.Marshal(credential)
+	if err != nil {
+		return Passkey{}, err
+	}
+	var passkey Passkey
+	err = s.DB.First(&passkey, "credential_id = ?", encodeCredentialID(credential.ID)).Error
+	if err != nil {
+		return Passkey{}, err
+	}
+	err = s.DB.Model(&passkey).Updates(map[string]any{
+		"credential":   string(raw),
+		"last_used_at": time.Now().Unix(),
+	}).Error
+	return passkey, err
+}
+
+func (s PasskeyService) Delete(id int) error {
+	result := s.DB.Delete(&Passkey{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
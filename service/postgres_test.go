@@ -0,0 +1,116 @@
+package service
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zjyl1994/arkdrop/migration"
+)
+
+// TestPostgres runs the migrations and the queries that differ between
+// dialects against the PostgreSQL database named by DATABASE_URL. Everything
+// in that database is dropped.
+func TestPostgres(t *testing.T) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	db, err := OpenDB(t.TempDir(), databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &Store{DB: db, DataDir: t.TempDir(), BodyLimit: 1 << 20, EventRetention: time.Hour}
+	t.Cleanup(func() { _ = store.Close() })
+
+	// Start from an empty schema, whatever an earlier run left behind.
+	if err := migration.Down(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := migration.Up(db, migration.Latest()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("parcels", func(t *testing.T) {
+		parcels := ParcelService{Store: store}
+		if _, err := parcels.Create(Parcel{Content: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+		first, created, err := parcels.RecordTransfer(Parcel{Content: "transfer", TransferID: "t1"})
+		if err != nil || !created {
+			t.Fatalf("first report: created = %v, %v", created, err)
+		}
+		again, created, err := parcels.RecordTransfer(Parcel{Content: "transfer", TransferID: "t1"})
+		if err != nil || created || again.ID != first.ID {
+			t.Fatalf("second report: id = %d, created = %v, %v, want id %d", again.ID, created, err, first.ID)
+		}
+		list, err := parcels.List(nil, "")
+		if err != nil || len(list) != 2 {
+			t.Fatalf("list = %d parcels, %v, want 2", len(list), err)
+		}
+
+		for _, want := range []bool{true, false} {
+			if err := parcels.Favorite(first.ID); err != nil {
+				t.Fatal(err)
+			}
+			favorite := true
+			list, err := parcels.List(&favorite, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(list) == 1 && list[0].ID == first.ID; got != want {
+				t.Fatalf("favorites = %d parcels after toggling, want favorite %v", len(list), want)
+			}
+		}
+	})
+
+	t.Run("audit trigger", func(t *testing.T) {
+		if err := (AuditService{Store: store}).Record(AuditEvent{Type: AuditParcelCreate}, map[string]any{"id": 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Exec("UPDATE audit_events SET type = 'changed'").Error; err == nil {
+			t.Error("audit events could be updated")
+		}
+		if err := db.Exec("DELETE FROM audit_events").Error; err == nil {
+			t.Error("audit events could be deleted")
+		}
+	})
+
+	t.Run("clipboard upsert", func(t *testing.T) {
+		clipboard := ClipboardService{Store: store}
+		for _, entry := range []struct {
+			seq     int64
+			message string
+		}{{2, "second"}, {1, "late first"}, {3, "third"}} {
+			if err := clipboard.Save("default", entry.seq, []byte(entry.message)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		latest, err := clipboard.Latest("default")
+		if err != nil || latest.Seq != 3 || latest.Message != "third" {
+			t.Fatalf("latest = %d %q, %v, want 3 \"third\"", latest.Seq, latest.Message, err)
+		}
+	})
+
+	t.Run("hub events", func(t *testing.T) {
+		events := HubEventService{Store: store}
+		for range 3 {
+			if err := events.Append(&HubEvent{Channel: "default", MsgType: 1, Payload: []byte("hi")}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		list, err := events.Since(0, "default", "", 10)
+		if err != nil || len(list) != 3 {
+			t.Fatalf("since 0 = %d events, %v, want 3", len(list), err)
+		}
+	})
+
+	if err := migration.Down(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"parcels", "audit_events", "clipboard_entries", "hub_events", "auth_sessions"} {
+		if db.Migrator().HasTable(table) {
+			t.Errorf("table %s left after down", table)
+		}
+	}
+}
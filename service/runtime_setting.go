@@ -0,0 +1,160 @@
+package service
+
+import (
+	"time"
+
+	"github.com/zjyl1994/arkdrop/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	settingAutoExpire           = "runtime.auto_expire"
+	settingAttachmentLinkExpire = "runtime.attachment_link_expire"
+	settingUploadLimit          = "runtime.upload_limit"
+	settingCleanupInterval      = "runtime.cleanup_interval"
+)
+
+// RuntimeSettings are the options an admin can change while the server runs.
+// Values stored in the settings table override the startup configuration.
+type RuntimeSettings struct {
+	AutoExpire           time.Duration
+	AttachmentLinkExpire time.Duration
+	UploadLimit          int64
+	CleanupInterval      time.Duration
+}
+
+// CurrentSettings returns the runtime settings in effect.
+func (s *Store) CurrentSettings() RuntimeSettings {
+	s.settingsMutex.RLock()
+	defer s.settingsMutex.RUnlock()
+	return s.settings
+}
+
+// WatchSettings returns a channel that receives the settings after each
+// update. Only the latest value is kept when the reader falls behind.
+func (s *Store) WatchSettings() <-chan RuntimeSettings {
+	s.settingsMutex.Lock()
+	defer s.settingsMutex.Unlock()
+	ch := make(chan RuntimeSettings, 1)
+	s.settingsWatchers = append(s.settingsWatchers, ch)
+	return ch
+}
+
+type SettingService struct{ *Store }
+
+// Load makes defaults current after applying the overrides stored in the database.
+func (s SettingService) Load(defaults RuntimeSettings) error {
+	settings := defaults
+	durations := map[string]*time.Duration{
+		settingAutoExpire:           &settings.AutoExpire,
+		settingAttachmentLinkExpire: &settings.AttachmentLinkExpire,
+		settingCleanupInterval:      &settings.CleanupInterval,
+	}
+	for key, target := range durations {
+		value, err := s.getSetting(key)
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			continue
+		}
+		if *target, err = utils.ParseDuration(value); err != nil {
+			return err
+		}
+	}
+	value, err := s.getSetting(settingUploadLimit)
+	if err != nil {
+		return err
+	}
+	if value != "" {
+		if settings.UploadLimit, err = utils.ParseSize(value); err != nil {
+			return err
+		}
+	}
+
+	// body_limit may have been lowered since the upload limit was stored.
+	if settings.UploadLimit > int64(s.BodyLimit) {
+		settings.UploadLimit = int64(s.BodyLimit)
+	}
+
+	s.settingsMutex.Lock()
+	s.settings = settings
+	s.settingsMutex.Unlock()
+	return nil
+}
+
+// RuntimeSettingsChange names the runtime settings to change. Nil fields keep
+// their current value.
+type RuntimeSettingsChange struct {
+	AutoExpire           *time.Duration
+	AttachmentLinkExpire *time.Duration
+	UploadLimit          *int64
+	CleanupInterval      *time.Duration
+}
+
+// Update stores the changed settings and makes them current at once. Only
+// their keys are written, so concurrent updates of other settings, here or
+// on another instance, are kept. It returns the settings now in effect.
+func (s SettingService) Update(change RuntimeSettingsChange) (RuntimeSettings, error) {
+	s.settingsMutex.Lock()
+	defer s.settingsMutex.Unlock()
+
+	settings := s.settings
+	values := make(map[string]string)
+	durations := []struct {
+		key    string
+		value  *time.Duration
+		target *time.Duration
+	}{
+		{settingAutoExpire, change.AutoExpire, &settings.AutoExpire},
+		{settingAttachmentLinkExpire, change.AttachmentLinkExpire, &settings.AttachmentLinkExpire},
+		{settingCleanupInterval, change.CleanupInterval, &settings.CleanupInterval},
+	}
+	for _, field := range durations {
+		if field.value != nil {
+			*field.target = *field.value
+			values[field.key] = utils.FormatDuration(*field.value)
+		}
+	}
+	if change.UploadLimit != nil {
+		settings.UploadLimit = *change.UploadLimit
+		values[settingUploadLimit] = utils.FormatSize(*change.UploadLimit)
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		for key, value := range values {
+			if err := setSetting(tx, key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return RuntimeSettings{}, err
+	}
+
+	s.settings = settings
+	s.notifySettingsLocked(settings)
+	return settings, nil
+}
+
+// Reload picks up the settings another instance stored and notifies watchers.
+func (s SettingService) Reload() error {
+	if err := s.Load(s.CurrentSettings()); err != nil {
+		return err
+	}
+	s.settingsMutex.Lock()
+	defer s.settingsMutex.Unlock()
+	s.notifySettingsLocked(s.settings)
+	return nil
+}
+
+func (s *Store) notifySettingsLocked(settings RuntimeSettings) {
+	for _, ch := range s.settingsWatchers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- settings
+	}
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// getSetting returns the stored value for key, or an empty string when it has never been set.
+func (s *Store) getSetting(key string) (string, error) {
+	var setting Setting
+	err := s.DB.First(&setting, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return setting.Value, nil
+}
+
+func setSetting(tx *gorm.DB, key, value string) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&Setting{Key: key, Value: value}).Error
+}
+
+func deleteSetting(tx *gorm.DB, key string) error {
+	return tx.Delete(&Setting{}, "key = ?", key).Error
+}
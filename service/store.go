@@ -0,0 +1,58 @@
+package service
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	gorm_logrus "github.com/onrik/gorm-logrus"
+	"github.com/zjyl1994/arkdrop/metrics"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Store is what the services of one instance share. Services embed it, so
+// instances living in the same process never see each other's data.
+type Store struct {
+	DB             *gorm.DB
+	DataDir        string
+	BodyLimit      int
+	EventRetention time.Duration
+	Metrics        *metrics.Metrics
+
+	settings         RuntimeSettings
+	settingsMutex    sync.RWMutex
+	settingsWatchers []chan RuntimeSettings
+}
+
+// OpenDB connects to PostgreSQL when databaseURL is set, otherwise to the
+// SQLite database in dataDir.
+func OpenDB(dataDir, databaseURL string) (*gorm.DB, error) {
+	dialector := sqlite.Open(filepath.Join(dataDir, "arkdrop.db"))
+	if databaseURL != "" {
+		dialector = postgres.Open(databaseURL)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: gorm_logrus.New(),
+		// Reports unique violations as gorm.ErrDuplicatedKey on every driver.
+		TranslateError: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if db.Dialector.Name() == "sqlite" {
+		if err := db.Exec("PRAGMA journal_mode=WAL;").Error; err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func (s *Store) Close() error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
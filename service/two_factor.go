@@ -0,0 +1,190 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/zjyl1994/arkdrop/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	settingTOTPSecret        = "totp_secret"
+	settingTOTPPendingSecret = "totp_pending_secret"
+	// settingTOTPLastStep holds the time step of the last accepted code, so no code works twice.
+	settingTOTPLastStep = "totp_last_step"
+
+	totpIssuer        = "ArkDrop"
+	totpAccountName   = "arkdrop"
+	totpPeriod        = 30
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrTwoFactorNotPending = errors.New("no pending two-factor enrollment")
+	ErrInvalidOTP          = errors.New("invalid one-time password")
+)
+
+type TwoFactorService struct{ *Store }
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// totpStep returns the time step code is valid for, allowing one step of clock skew either way.
+func totpStep(code, secret string) (int64, bool) {
+	code = strings.TrimSpace(code)
+	now := time.Now()
+	for _, skew := range []int64{0, -1, 1} {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCode(secret, at)
+		if err == nil && subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1 {
+			return at.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// useTOTPStep records step as used. It fails with ErrInvalidOTP when a code
+// of this or a later step was accepted before.
+func useTOTPStep(tx *gorm.DB, step int64) error {
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Setting{Key: settingTOTPLastStep, Value: "0"}).Error
+	if err != nil {
+		return err
+	}
+	result := tx.Model(&Setting{}).
+		Where("key = ? AND CAST(value AS bigint) < ?", settingTOTPLastStep, step).
+		Update("value", strconv.FormatInt(step, 10))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidOTP
+	}
+	return nil
+}
+
+func (s TwoFactorService) Enabled() (bool, error) {
+	secret, err := s.getSetting(settingTOTPSecret)
+	return secret != "", err
+}
+
+// BeginEnroll generates a new secret and keeps it pending until it is confirmed with a valid code.
+func (s TwoFactorService) BeginEnroll() (*otp.Key, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: totpAccountName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := setSetting(s.DB, settingTOTPPendingSecret, key.Secret()); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ConfirmEnroll activates the pending secret and returns a fresh set of plain-text recovery codes.
+func (s TwoFactorService) ConfirmEnroll(code string) ([]string, error) {
+	pendingSecret, err := s.getSetting(settingTOTPPendingSecret)
+	if err != nil {
+		return nil, err
+	}
+	if pendingSecret == "" {
+		return nil, ErrTwoFactorNotPending
+	}
+	step, ok := totpStep(code, pendingSecret)
+	if !ok {
+		return nil, ErrInvalidOTP
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]RecoveryCode, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code := strings.ToLower(utils.SecureRandString(5) + "-" + utils.SecureRandString(5))
+		codes = append(codes, code)
+		records = append(records, RecoveryCode{CodeHash: hashRecoveryCode(code)})
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&records).Error; err != nil {
+			return err
+		}
+		if err := setSetting(tx, settingTOTPSecret, pendingSecret); err != nil {
+			return err
+		}
+		// Steps of the old secret mean nothing for the new one.
+		if err := setSetting(tx, settingTOTPLastStep, strconv.FormatInt(step, 10)); err != nil {
+			return err
+		}
+		return deleteSetting(tx, settingTOTPPendingSecret)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify accepts either a current TOTP code that was not used before or an
+// unused recovery code. Either is consumed.
+func (s TwoFactorService) Verify(code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrInvalidOTP
+	}
+
+	secret, err := s.getSetting(settingTOTPSecret)
+	if err != nil {
+		return err
+	}
+	if secret != "" {
+		if step, ok := totpStep(code, secret); ok {
+			return useTOTPStep(s.DB, step)
+		}
+	}
+
+	result := s.DB.Model(&RecoveryCode{}).
+		Where("code_hash = ? AND used_at = 0", hashRecoveryCode(code)).
+		Update("used_at", time.Now().Unix())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidOTP
+	}
+	return nil
+}
+
+func (s TwoFactorService) RemainingRecoveryCodes() (int64, error) {
+	var count int64
+	err := s.DB.Model(&RecoveryCode{}).Where("used_at = 0").Count(&count).Error
+	return count, err
+}
+
+func (s TwoFactorService) Disable() error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := deleteSetting(tx, settingTOTPPendingSecret); err != nil {
+			return err
+		}
+		if err := deleteSetting(tx, settingTOTPLastStep); err != nil {
+			return err
+		}
+		return deleteSetting(tx, settingTOTPSecret)
+	})
+}
@@ -0,0 +1,219 @@
+package startup
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zjyl1994/arkdrop"
+	"github.com/zjyl1994/arkdrop/client"
+	"github.com/zjyl1994/arkdrop/config"
+	"github.com/zjyl1994/arkdrop/discovery"
+	"github.com/zjyl1994/arkdrop/migration"
+	"github.com/zjyl1994/arkdrop/service"
+	"github.com/zjyl1994/arkdrop/utils"
+	"gorm.io/gorm"
+)
+
+// RunCommand executes a maintenance command given on the command line instead of starting the server.
+func RunCommand(args []string) error {
+	switch args[0] {
+	case "2fa":
+		return runTwoFactorCommand(args[1:])
+	case "clip":
+		return runClipCommand(args[1:])
+	case "discover":
+		return runDiscoverCommand(args[1:])
+	case "config":
+		return runConfigCommand(args[1:])
+	case "migrate":
+		return runMigrateCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", strings.Join(args, " "))
+	}
+}
+
+func runTwoFactorCommand(args []string) error {
+	if len(args) == 0 || args[0] != "disable" {
+		return fmt.Errorf("usage: arkdrop 2fa disable [-config FILE]")
+	}
+
+	cfg, err := config.Load(args[1:])
+	if err != nil {
+		return err
+	}
+	db, err := arkdrop.OpenDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	store := &service.Store{DB: db, DataDir: cfg.DataDir}
+	defer store.Close()
+
+	if err := (service.TwoFactorService{Store: store}).Disable(); err != nil {
+		return err
+	}
+	err = service.AuditService{Store: store}.Record(service.AuditEvent{Type: service.AuditTwoFactorOff}, map[string]any{
+		"source": "cli",
+	})
+	if err != nil {
+		logrus.Errorln("Record audit event failed:", err)
+	}
+	logrus.Infoln("Two-factor authentication disabled.")
+	return nil
+}
+
+func runClipCommand(args []string) error {
+	if len(args) == 0 || args[0] != "watch" {
+		return fmt.Errorf("usage: arkdrop clip watch [-server URL] [-token TOKEN] [-channel NAME] [-interval 1s]")
+	}
+
+	var opts client.ClipWatchOptions
+	fs := flag.NewFlagSet("clip watch", flag.ContinueOnError)
+	fs.StringVar(&opts.Server, "server", utils.COALESCE(os.Getenv("ARKDROP_SERVER"), "http://127.0.0.1:8080"), "ArkDrop base URL")
+	fs.StringVar(&opts.Token, "token", os.Getenv("ARKDROP_TOKEN"), "access token, e.g. from device pairing")
+	fs.StringVar(&opts.Channel, "channel", "", "hub channel to mirror")
+	fs.DurationVar(&opts.Interval, "interval", time.Second, "local clipboard polling interval")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if opts.Token == "" {
+		return fmt.Errorf("missing token, pass -token or set ARKDROP_TOKEN")
+	}
+	if opts.Interval <= 0 {
+		return fmt.Errorf("invalid interval %s", opts.Interval)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return client.WatchClipboard(ctx, opts)
+}
+
+func runDiscoverCommand(args []string) error {
+	fs := flag.NewFlagSet("discover", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 2*time.Second, "how long to wait for answers")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The mDNS client logs every query through the standard logger.
+	log.SetOutput(io.Discard)
+	instances, err := discovery.Browse(*timeout)
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		fmt.Println("No ArkDrop instance found on the local network.")
+		return nil
+	}
+	for _, instance := range instances {
+		fmt.Printf("%s\t%s\t%s\n", instance.Name, instance.URL(), utils.COALESCE(instance.Version, "unknown"))
+	}
+	return nil
+}
+
+func runConfigCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: arkdrop config print [flags] | arkdrop config schema")
+	}
+	switch args[0] {
+	case "print":
+		cfg, err := config.Load(args[1:])
+		if err != nil {
+			return err
+		}
+		return cfg.Print(os.Stdout)
+	case "schema":
+		return config.WriteSchema(os.Stdout)
+	default:
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
+
+// runMigrateCommand shows or changes the schema version. up defaults to the
+// latest version and down to one step back; both back up the database first.
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: arkdrop migrate status | up [VERSION] | down [VERSION] [-config FILE]")
+	}
+	action, args := args[0], args[1:]
+	target := -1
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < 0 || action == "status" {
+			return fmt.Errorf("unexpected argument %q", args[0])
+		}
+		target, args = version, args[1:]
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+	db, err := service.OpenDB(cfg.DataDir, cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	store := &service.Store{DB: db, DataDir: cfg.DataDir}
+	defer store.Close()
+	backupDir := filepath.Join(cfg.DataDir, "backups")
+
+	switch action {
+	case "status":
+		return printMigrationStatus(db)
+	case "up":
+		if target < 0 {
+			target = migration.Latest()
+		}
+		return migration.Migrate(db, backupDir, target, cfg.MigrateWithoutBackup)
+	case "down":
+		if target < 0 {
+			current, err := migration.Check(db)
+			if err != nil {
+				return err
+			}
+			if current == 0 {
+				return fmt.Errorf("no migration to roll back")
+			}
+			target = current - 1
+		}
+		return migration.Migrate(db, backupDir, target, cfg.MigrateWithoutBackup)
+	default:
+		return fmt.Errorf("unknown migrate command %q", action)
+	}
+}
+
+func printMigrationStatus(db *gorm.DB) error {
+	current, err := migration.Current(db)
+	if err != nil {
+		return err
+	}
+	states, err := migration.Status(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Schema version %d, this binary supports up to %d.\n", current, migration.Latest())
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE")
+	for _, state := range states {
+		status := "pending"
+		switch {
+		case state.Unknown:
+			status = "applied by a newer binary " + state.AppliedAt.Format(time.DateTime)
+		case state.Applied():
+			status = "applied " + state.AppliedAt.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", state.Version, state.Name, status)
+	}
+	return w.Flush()
+}
@@ -1,89 +1,41 @@
 package startup
 
 import (
-	"fmt"
+	"context"
 	"os"
-	"path/filepath"
-	"strconv"
-	"time"
+	"os/signal"
+	"syscall"
 
 	_ "github.com/joho/godotenv/autoload"
-	gorm_logrus "github.com/onrik/gorm-logrus"
 	"github.com/sirupsen/logrus"
-	"github.com/zjyl1994/arkdrop/server"
-	"github.com/zjyl1994/arkdrop/service"
-	"github.com/zjyl1994/arkdrop/utils"
-	"github.com/zjyl1994/arkdrop/vars"
-	"github.com/zjyl1994/cap-go"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
+	"github.com/zjyl1994/arkdrop"
+	"github.com/zjyl1994/arkdrop/config"
 )
 
-func Start() (err error) {
-	vars.DebugMode, _ = strconv.ParseBool(os.Getenv("ARKDROP_DEBUG"))
-	if vars.DebugMode {
-		logrus.SetLevel(logrus.DebugLevel)
-		logrus.Debugln("ArkDrop in DEBUG mode.")
-	}
-	vars.ListenAddr = utils.COALESCE(os.Getenv("ARKDROP_LISTEN"), ":8080")
-	vars.DataDir = os.Getenv("ARKDROP_DATA_DIR")
-	err = os.MkdirAll(filepath.Join(vars.DataDir, "files"), 0755)
+func Start(args []string) (err error) {
+	cfg, err := config.Load(args)
 	if err != nil {
 		return err
 	}
-	vars.Password = os.Getenv("ARKDROP_PASSWORD")
-	vars.CapInstance = cap.NewCap(utils.NewFreeCacheStorage(50 * 1024))
-
-	autoExpireDuration := utils.COALESCE(os.Getenv("ARKDROP_AUTO_EXPIRE"), "1w")
-	vars.AutoExpire, err = utils.ParseDuration(autoExpireDuration)
-	if err != nil {
-		return err
+	if cfg.Debug {
+		logrus.SetLevel(logrus.DebugLevel)
+		logrus.Debugln("ArkDrop in DEBUG mode.")
 	}
 
-	attachmentLinkExpireDuration := utils.COALESCE(os.Getenv("ARKDROP_ATTACHMENT_LINK_EXPIRE"), "1h")
-	vars.AttachmentLinkExpire, err = utils.ParseDuration(attachmentLinkExpireDuration)
+	app, err := arkdrop.New(*cfg)
 	if err != nil {
 		return err
 	}
-	if vars.AttachmentLinkExpire <= 0 {
-		return fmt.Errorf("ARKDROP_ATTACHMENT_LINK_EXPIRE must be greater than 0")
-	}
 
-	dbFile := filepath.Join(vars.DataDir, "arkdrop.db")
-	vars.DB, err = gorm.Open(sqlite.Open(dbFile), &gorm.Config{
-		Logger: gorm_logrus.New(),
-	})
-	if err != nil {
-		return err
-	}
-	err = vars.DB.Exec("PRAGMA journal_mode=WAL;").Error
-	if err != nil {
-		return err
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	err = vars.DB.AutoMigrate(&service.Parcel{}, &service.Attachment{}, &service.AttachmentShare{})
-	if err != nil {
-		return err
+	err = app.Run(ctx)
+	if closeErr := app.Close(); closeErr != nil {
+		logrus.Errorln("Close database failed:", closeErr)
 	}
-	go func() {
-		doClean := func() {
-			var service service.ParcelService
-			err := service.CleanExpired()
-			if err != nil {
-				logrus.Errorln("Clean expired parcels failed:", err)
-			}
-			err = service.CleanExpiredAttachmentShares()
-			if err != nil {
-				logrus.Errorln("Clean expired attachment shares failed:", err)
-			}
-		}
-
-		doClean()
-
-		ticker := time.Tick(vars.AUTO_EXPIRE_INTERVAL)
-		for range ticker {
-			doClean()
-		}
-	}()
-	return server.Run(vars.ListenAddr)
+	if err == nil {
+		logrus.Infoln("ArkDrop stopped.")
+	}
+	return err
 }
@@ -1,10 +1,14 @@
 package utils
 
 import (
+	crand "crypto/rand"
+	"math/big"
 	"math/rand/v2"
 	"strings"
 )
 
+const randCharsets = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
 func COALESCE[T comparable](elem ...T) T {
 	var empty T
 	for _, item := range elem {
@@ -15,11 +19,42 @@ func COALESCE[T comparable](elem ...T) T {
 	return empty
 }
 
+// RandString suits names that only need to be unique. Use SecureRandString
+// for anything an attacker must not guess.
 func RandString(n int) string {
-	const charsets = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	var sb strings.Builder
 	for range n {
-		sb.WriteByte(charsets[rand.IntN(len(charsets))])
+		sb.WriteByte(randCharsets[rand.IntN(len(randCharsets))])
+	}
+	return sb.String()
+}
+
+// SecureRandString draws from crypto/rand, for tokens, codes and secrets.
+func SecureRandString(n int) string {
+	var sb strings.Builder
+	for range n {
+		sb.WriteByte(randCharsets[SecureRandIntN(len(randCharsets))])
 	}
 	return sb.String()
 }
+
+// SecureRandIntN returns a uniform number in [0, n) drawn from crypto/rand.
+func SecureRandIntN(n int) int {
+	v, err := crand.Int(crand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		// crypto/rand does not fail on supported platforms.
+		panic(err)
+	}
+	return int(v.Int64())
+}
+
+// SplitList splits a comma separated value, dropping blank items.
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
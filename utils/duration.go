@@ -45,3 +45,13 @@ func ParseDuration(s string) (time.Duration, error) {
 	}
 	return dur, nil
 }
+
+// FormatDuration prints d in the largest unit ParseDuration accepts that divides it exactly.
+func FormatDuration(d time.Duration) string {
+	for _, unit := range []string{"w", "d", "h", "m", "s", "ms"} {
+		if d != 0 && d%units[unit] == 0 {
+			return strconv.FormatInt(int64(d/units[unit]), 10) + unit
+		}
+	}
+	return d.String()
+}
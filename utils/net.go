@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+)
+
+// LANAddrs lists the non-loopback, non link-local addresses of the interfaces that are up.
+func LANAddrs() ([]net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no LAN address found")
+	}
+	return ips, nil
+}
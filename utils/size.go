@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sizeRE = regexp.MustCompile(`^(\d+)\s*([KMGT]?)(?:I?B)?$`)
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+// ParseSize reads a byte count such as 1048576, 512KB or 10MiB. Units are binary.
+func ParseSize(s string) (int64, error) {
+	m := sizeRE.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	val, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	for _, unit := range sizeUnits {
+		if unit.suffix == m[2] {
+			return val * unit.bytes, nil
+		}
+	}
+	return val, nil
+}
+
+// FormatSize prints n with the largest unit that divides it exactly.
+func FormatSize(n int64) string {
+	for _, unit := range sizeUnits {
+		if n != 0 && n%unit.bytes == 0 {
+			return strconv.FormatInt(n/unit.bytes, 10) + unit.suffix + "B"
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
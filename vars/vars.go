@@ -3,23 +3,19 @@ package vars
 import (
 	"time"
 
-	"github.com/zjyl1994/cap-go"
-	"gorm.io/gorm"
+	"github.com/zjyl1994/arkdrop/config"
 )
 
-var (
-	ListenAddr           string
-	DataDir              string
-	DebugMode            bool
-	Password             string
-	AutoExpire           time.Duration
-	AttachmentLinkExpire time.Duration
+// Version is set at build time with -ldflags "-X github.com/zjyl1994/arkdrop/vars.Version=...".
+var Version = "dev"
 
-	DB          *gorm.DB
-	CapInstance cap.ICap
+const (
+	TLS_MODE_OFF         = config.TLSModeOff
+	TLS_MODE_FILE        = config.TLSModeFile
+	TLS_MODE_SELF_SIGNED = config.TLSModeSelfSigned
+	TLS_MODE_ACME        = config.TLSModeACME
 )
 
 const (
-	JWT_TOKEN_EXPIRE     = 24 * 30 * time.Hour
-	AUTO_EXPIRE_INTERVAL = time.Hour
+	JWT_TOKEN_EXPIRE = 24 * 30 * time.Hour
 )
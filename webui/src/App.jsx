@@ -1,9 +1,12 @@
 import { BrowserRouter, Routes, Route, Link } from 'react-router-dom';
 import HomePage from './routes/HomePage';
 import LoginPage from './routes/LoginPage';
+import PairPage from './routes/PairPage';
+import SetupPage from './routes/SetupPage';
 import PrivateRoute from './routes/PrivateRoute';
 import AppNavBar from './compoments/AppNavBar';
 import { PageActionsProvider } from './contexts/PageActionsContext';
+import { basePath } from './utils/basePath';
 import './assets/scrollbar.css';
 
 const themeColor = indigo[500];
@@ -45,10 +48,12 @@ function App() {
     <ThemeProvider theme={theme}>
       <CssBaseline />
       <PageActionsProvider>
-        <BrowserRouter>
+        <BrowserRouter basename={basePath || '/'}>
           <AppNavBar />
           <Routes>
             <Route path="/login" element={<LoginPage />} />
+            <Route path="/pair" element={<PairPage />} />
+            <Route path="/setup" element={<SetupPage />} />
             <Route
               path="/"
               element={
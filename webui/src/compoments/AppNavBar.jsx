@@ -1,24 +1,33 @@
+import axios from 'axios';
 import Cookies from 'js-cookie';
 import { Drawer, ListItemButton } from '@mui/material';
 import ClearAllRounded from '@mui/icons-material/ClearAllRounded';
 import GridView from '@mui/icons-material/GridView';
 import HomeRounded from '@mui/icons-material/HomeRounded';
+import KeyRounded from '@mui/icons-material/KeyRounded';
 import LogoutRounded from '@mui/icons-material/LogoutRounded';
 import MenuRounded from '@mui/icons-material/MenuRounded';
+import QrCode2Rounded from '@mui/icons-material/QrCode2Rounded';
 import StarRounded from '@mui/icons-material/StarRounded';
 import ViewList from '@mui/icons-material/ViewList';
 import { useLocation, useNavigate } from 'react-router-dom';
 import { usePageActions } from '../contexts/PageActionsContext';
+import PairDeviceDialog from './PairDeviceDialog';
+import PasskeyDialog from './PasskeyDialog';
+import { passkeySupported } from '../utils/passkey';
 
 export default function AppNavBar() {
     const navigate = useNavigate();
     const location = useLocation();
     const { pageActions } = usePageActions();
-    const isAuthenticated = !!Cookies.get('droptoken');
-    const showAppShell = isAuthenticated && location.pathname !== '/login';
+    const isAuthenticated = !!Cookies.get('droplogin');
+    const showAppShell = isAuthenticated && location.pathname !== '/login' && location.pathname !== '/pair' && location.pathname !== '/setup';
     const showPageActions = showAppShell && pageActions.hasPageActions;
     const currentTab = location.pathname === '/favorites' ? '/favorites' : '/';
     const [drawerOpen, setDrawerOpen] = useState(false);
+    const [pairDialogOpen, setPairDialogOpen] = useState(false);
+    const [passkeyDialogOpen, setPasskeyDialogOpen] = useState(false);
+    const [passkeyEnabled, setPasskeyEnabled] = useState(false);
     const buildTimeText = import.meta.env.VITE_BUILD_TIMESTAMP || '未知';
     const navItems = [
         { label: '首页', value: '/', icon: <HomeRounded /> },
@@ -97,6 +106,15 @@ export default function AppNavBar() {
         fontSize: '0.95rem',
     };
 
+    useEffect(() => {
+        if (!showAppShell || !passkeySupported()) {
+            return;
+        }
+        axios.get('/api/passkey/config')
+            .then((res) => setPasskeyEnabled(Boolean(res.data?.enabled)))
+            .catch(() => setPasskeyEnabled(false));
+    }, [showAppShell]);
+
     const handleDrawerOpen = () => {
         setDrawerOpen(true);
     };
@@ -110,9 +128,23 @@ export default function AppNavBar() {
         handleDrawerClose();
     };
 
+    const handlePairDevice = () => {
+        handleDrawerClose();
+        setPairDialogOpen(true);
+    };
+
+    const handlePasskeys = () => {
+        handleDrawerClose();
+        setPasskeyDialogOpen(true);
+    };
+
     const handleLogout = async () => {
         handleDrawerClose();
-        Cookies.remove('droptoken');
+        try {
+            await axios.post('/api/logout');
+        } catch (error) {
+            console.error('Logout failed', error);
+        }
         navigate('/login');
     }
 
@@ -295,6 +327,20 @@ export default function AppNavBar() {
                         </Box>
 
                         <List sx={{ px: 1, py: 1, pb: 'calc(8px + env(safe-area-inset-bottom))' }}>
+                            {renderDrawerItem({
+                                key: 'pair',
+                                label: '配对新设备',
+                                icon: <QrCode2Rounded />,
+                                onClick: handlePairDevice,
+                                iconColor: 'inherit',
+                            })}
+                            {passkeyEnabled && renderDrawerItem({
+                                key: 'passkeys',
+                                label: '通行密钥',
+                                icon: <KeyRounded />,
+                                onClick: handlePasskeys,
+                                iconColor: 'inherit',
+                            })}
                             {renderDrawerItem({
                                 key: 'logout',
                                 label: '退出登录',
@@ -306,6 +352,14 @@ export default function AppNavBar() {
                     </Box>
                 </Drawer>
             )}
+
+            {showAppShell && (
+                <PairDeviceDialog open={pairDialogOpen} onClose={() => setPairDialogOpen(false)} />
+            )}
+
+            {showAppShell && passkeyEnabled && (
+                <PasskeyDialog open={passkeyDialogOpen} onClose={() => setPasskeyDialogOpen(false)} />
+            )}
         </Box>
     )
 }
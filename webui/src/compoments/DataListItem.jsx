@@ -3,6 +3,7 @@ import dayjs from 'dayjs';
 import relativeTime from 'dayjs/plugin/relativeTime';
 import 'dayjs/locale/zh-cn';
 import LinkRounded from '@mui/icons-material/LinkRounded';
+import { withBase } from '../utils/basePath';
 
 dayjs.extend(relativeTime);
 dayjs.locale('zh-cn');
@@ -109,7 +110,7 @@ const DataListItem = ({
       // Add first image if available
       if (imageList.length > 0) {
         const imageFile = imageList[0];
-        const imageUrl = `/files/${imageFile.file_path}`;
+        const imageUrl = `${withBase('/files/')}${imageFile.file_path}`;
         
         try {
           const img = new Image();
@@ -172,7 +173,7 @@ const DataListItem = ({
       const res = await axios.get(`/api/attachment/share-link?id=${file.id}`, {
         withCredentials: true,
       });
-      const shareLink = new URL(res.data.path, window.location.origin).toString();
+      const shareLink = res.data.url || new URL(res.data.path, window.location.origin).toString();
 
       await navigator.clipboard.writeText(shareLink);
 
@@ -287,10 +288,10 @@ const DataListItem = ({
                   {imageList.map(file =>
                     <ImageListItem key={file.id}>
                       <img
-                        src={`/files/${file.file_path}`}
+                        src={`${withBase('/files/')}${file.file_path}`}
                         alt={file.file_name}
                         loading="lazy"
-                        onClick={() => onImagePreview(`/files/${file.file_path}`, file.file_name)}
+                        onClick={() => onImagePreview(`${withBase('/files/')}${file.file_path}`, file.file_name)}
                         style={{ 
                           cursor: 'pointer',
                           width: '100%',
@@ -361,7 +362,7 @@ const DataListItem = ({
                         <LinkRounded fontSize="small" />
                       </IconButton>
                       <a
-                        href={`/files/${file.file_path}`}
+                        href={`${withBase('/files/')}${file.file_path}`}
                         download={file.file_name}
                         target="_blank"
                         rel="noopener noreferrer"
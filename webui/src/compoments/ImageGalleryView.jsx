@@ -1,6 +1,7 @@
 import dayjs from 'dayjs';
 import { useTheme } from '@mui/material/styles';
 import useMediaQuery from '@mui/material/useMediaQuery';
+import { withBase } from '../utils/basePath';
 
 const ImageGalleryView = ({ images, onImagePreview }) => {
   const theme = useTheme();
@@ -60,10 +61,10 @@ const ImageGalleryView = ({ images, onImagePreview }) => {
       {images.map((image) => (
         <ImageListItem key={`${image.itemId}-${image.id}`}>
           <img
-            src={`/files/${image.file_path}`}
+            src={`${withBase('/files/')}${image.file_path}`}
             alt={image.file_name}
             loading="lazy"
-            onClick={() => onImagePreview(`/files/${image.file_path}`, image.file_name)}
+            onClick={() => onImagePreview(`${withBase('/files/')}${image.file_path}`, image.file_name)}
             style={{
               cursor: 'pointer',
               width: '100%',
@@ -79,7 +80,7 @@ const ImageGalleryView = ({ images, onImagePreview }) => {
                 sx={{ color: 'rgba(255, 255, 255, 0.8)' }}
                 onClick={(e) => {
                   e.stopPropagation();
-                  onImagePreview(`/files/${image.file_path}`, image.file_name);
+                  onImagePreview(`${withBase('/files/')}${image.file_path}`, image.file_name);
                 }}
               >
                 <ZoomIn />
@@ -0,0 +1,72 @@
+import axios from 'axios';
+
+export default function PairDeviceDialog({ open, onClose }) {
+  const [pairing, setPairing] = useState(null);
+  const [errMsg, setErrMsg] = useState('');
+  const [remaining, setRemaining] = useState(0);
+
+  useEffect(() => {
+    if (!open) {
+      setPairing(null);
+      setErrMsg('');
+      return undefined;
+    }
+
+    let cancelled = false;
+    axios.post('/api/pair/create', {}, { withCredentials: true })
+      .then((res) => {
+        if (!cancelled) {
+          setPairing(res.data);
+        }
+      })
+      .catch((err) => {
+        console.error('Failed to create pairing code:', err);
+        if (!cancelled) {
+          setErrMsg('生成配对码失败');
+        }
+      });
+    return () => {
+      cancelled = true;
+    };
+  }, [open]);
+
+  useEffect(() => {
+    if (!pairing) {
+      return undefined;
+    }
+    const tick = () => {
+      setRemaining(Math.max(0, pairing.expires_at - Math.floor(Date.now() / 1000)));
+    };
+    tick();
+    const timer = setInterval(tick, 1000);
+    return () => clearInterval(timer);
+  }, [pairing]);
+
+  return (
+    <Dialog open={open} onClose={onClose} maxWidth="xs" fullWidth>
+      <DialogTitle>配对新设备</DialogTitle>
+      <DialogContent>
+        {errMsg && <Alert severity="error">{errMsg}</Alert>}
+        {!errMsg && !pairing && (
+          <Box display="flex" justifyContent="center" py={4}>
+            <CircularProgress />
+          </Box>
+        )}
+        {pairing && (
+          <Box display="flex" flexDirection="column" alignItems="center">
+            <Box component="img" src={pairing.qr_code} alt="pairing QR code" sx={{ width: 220, height: 220 }} />
+            <Typography variant="h4" sx={{ fontFamily: 'monospace', letterSpacing: '0.2em', mt: 1 }}>
+              {pairing.code}
+            </Typography>
+            <Typography variant="body2" color="text.secondary" sx={{ mt: 1 }}>
+              {remaining > 0 ? `在新设备上扫码或输入配对码，${remaining} 秒后过期` : '配对码已过期'}
+            </Typography>
+          </Box>
+        )}
+      </DialogContent>
+      <DialogActions>
+        <Button onClick={onClose}>关闭</Button>
+      </DialogActions>
+    </Dialog>
+  );
+}
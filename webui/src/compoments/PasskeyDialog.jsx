@@ -0,0 +1,152 @@
+import axios from 'axios';
+import { registerPasskey } from '../utils/passkey';
+import ConfirmDialog from './ConfirmDialog';
+
+const formatTime = (seconds) => (seconds ? new Date(seconds * 1000).toLocaleString('zh-CN', { hour12: false }) : '从未使用');
+
+export default function PasskeyDialog({ open, onClose }) {
+  const [passkeys, setPasskeys] = useState(null);
+  const [name, setName] = useState('');
+  const [code, setCode] = useState('');
+  const [twoFactorEnabled, setTwoFactorEnabled] = useState(false);
+  const [busy, setBusy] = useState(false);
+  const [errMsg, setErrMsg] = useState('');
+  const [pendingDelete, setPendingDelete] = useState(null);
+
+  const loadPasskeys = useCallback(async () => {
+    try {
+      const res = await axios.get('/api/passkey/list', { withCredentials: true });
+      setPasskeys(res.data.list || []);
+    } catch (err) {
+      console.error('Failed to list passkeys:', err);
+      setErrMsg('获取通行密钥失败');
+      setPasskeys([]);
+    }
+  }, []);
+
+  useEffect(() => {
+    if (!open) {
+      setPasskeys(null);
+      setName('');
+      setCode('');
+      setErrMsg('');
+      return;
+    }
+    loadPasskeys();
+    axios.get('/api/2fa/status', { withCredentials: true })
+      .then((res) => setTwoFactorEnabled(Boolean(res.data?.enabled)))
+      .catch(() => setTwoFactorEnabled(false));
+  }, [open, loadPasskeys]);
+
+  const handleRegister = async () => {
+    setBusy(true);
+    setErrMsg('');
+    try {
+      await registerPasskey(name.trim(), code.trim());
+      setName('');
+      await loadPasskeys();
+    } catch (err) {
+      console.error('Failed to register passkey:', err);
+      // 用户在浏览器弹窗中取消时不算错误
+      if (err?.name !== 'NotAllowedError') {
+        setErrMsg(err.response?.data?.message || '添加通行密钥失败');
+      }
+    } finally {
+      // 验证码只能使用一次
+      setCode('');
+      setBusy(false);
+    }
+  };
+
+  const handleDelete = async () => {
+    setErrMsg('');
+    try {
+      await axios.post(`/api/passkey/delete?id=${pendingDelete.id}`, {}, { withCredentials: true });
+      await loadPasskeys();
+    } catch (err) {
+      console.error('Failed to delete passkey:', err);
+      setErrMsg(err.response?.data?.message || '删除通行密钥失败');
+    }
+  };
+
+  return (
+    <Dialog open={open} onClose={onClose} maxWidth="xs" fullWidth>
+      <DialogTitle>通行密钥</DialogTitle>
+      <DialogContent>
+        {errMsg && <Alert severity="error" sx={{ mb: 1 }}>{errMsg}</Alert>}
+        {!passkeys && (
+          <Box display="flex" justifyContent="center" py={4}>
+            <CircularProgress />
+          </Box>
+        )}
+        {passkeys && passkeys.length === 0 && (
+          <Typography variant="body2" color="text.secondary" sx={{ py: 2 }}>
+            还没有通行密钥
+          </Typography>
+        )}
+        {passkeys && passkeys.length > 0 && (
+          <List dense>
+            {passkeys.map((passkey) => (
+              <ListItem
+                key={passkey.id}
+                disableGutters
+                secondaryAction={(
+                  <Tooltip title="删除">
+                    <IconButton edge="end" aria-label="删除" onClick={() => setPendingDelete(passkey)}>
+                      <Delete />
+                    </IconButton>
+                  </Tooltip>
+                )}
+              >
+                <ListItemText
+                  primary={passkey.name}
+                  secondary={`添加于 ${formatTime(passkey.created_at)}，上次使用 ${formatTime(passkey.last_used_at)}`}
+                />
+              </ListItem>
+            ))}
+          </List>
+        )}
+        <Box display="flex" gap={1} alignItems="center" sx={{ mt: 1 }}>
+          <TextField
+            size="small"
+            label="名称"
+            placeholder="留空则按日期命名"
+            value={name}
+            onChange={(e) => setName(e.target.value)}
+            fullWidth
+          />
+          {twoFactorEnabled && (
+            <TextField
+              size="small"
+              label="动态验证码"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              inputProps={{ inputMode: 'numeric', autoComplete: 'one-time-code' }}
+              sx={{ width: 140, flexShrink: 0 }}
+            />
+          )}
+          <Button
+            variant="contained"
+            onClick={handleRegister}
+            disabled={busy || (twoFactorEnabled && !code.trim())}
+            sx={{ flexShrink: 0 }}
+          >
+            添加
+          </Button>
+        </Box>
+      </DialogContent>
+      <DialogActions>
+        <Button onClick={onClose}>关闭</Button>
+      </DialogActions>
+      <ConfirmDialog
+        open={Boolean(pendingDelete)}
+        onClose={() => setPendingDelete(null)}
+        onConfirm={handleDelete}
+        title="删除通行密钥"
+        message={pendingDelete ? `删除后将无法再用“${pendingDelete.name}”登录，确定删除吗？` : ''}
+        confirmText="删除"
+        confirmColor="error"
+      />
+    </Dialog>
+  );
+}
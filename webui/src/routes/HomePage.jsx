@@ -9,6 +9,7 @@ import ImagePreviewModal from '../compoments/ImagePreviewModal';
 import DataListItem from '../compoments/DataListItem';
 import ImageGalleryView from '../compoments/ImageGalleryView';
 import { usePageActions } from '../contexts/PageActionsContext';
+import { withBase } from '../utils/basePath';
 
 const authRequestConfig = { withCredentials: true };
 
@@ -106,7 +107,7 @@ const HomePage = ({ scope = 'all' }) => {
   // Fetch existing data on page load
   useEffect(() => {
     const wsProtocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    const ws = new WebSocket(`${wsProtocol}//${window.location.host}/api/ws?echo=1`);
+    const ws = new WebSocket(`${wsProtocol}//${window.location.host}${withBase('/api/ws')}?echo=1`);
     wsRef.current = ws;
 
     ws.onopen = () => {
@@ -117,7 +118,14 @@ const HomePage = ({ scope = 'all' }) => {
       console.log('Received WebSocket message:', event.data);
       if (event.data === 'list_change') {
         fetchData();
+        return;
       }
+      try {
+        // Expiry countdowns depend on auto_expire, so refresh the list.
+        if (JSON.parse(event.data)?.type === 'settings_changed') {
+          fetchData();
+        }
+      } catch (e) {}
     };
 
     ws.onerror = (error) => {
@@ -2,18 +2,24 @@ import axios from 'axios';
 import Cap from '@cap.js/widget';
 import { useNavigate } from 'react-router-dom';
 import { Checkbox, FormControlLabel } from '@mui/material';
+import { loginWithPasskey, passkeySupported } from '../utils/passkey';
+import { withBase } from '../utils/basePath';
 
 export default function LoginPage() {
   const [password, setPassword] = useState('');
   const [errMsg, setErrMsg] = useState('');
   const [remember, setRemember] = useState(false);
   const [capToken, setCapToken] = useState('');
+  const [otp, setOtp] = useState('');
+  const [otpRequired, setOtpRequired] = useState(false);
+  const [ssoEnabled, setSsoEnabled] = useState(false);
+  const [passkeyEnabled, setPasskeyEnabled] = useState(false);
   const capRef = useRef(null);
   const navigate = useNavigate();
 
   const refreshCap = async () => {
     if (!capRef.current) {
-      capRef.current = new Cap({ apiEndpoint: '/api/cap/' });
+      capRef.current = new Cap({ apiEndpoint: withBase('/api/cap/') });
     }
     try {
       if (capRef.current.reset) capRef.current.reset();
@@ -33,9 +39,24 @@ export default function LoginPage() {
   };
 
   useEffect(() => {
-    capRef.current = new Cap({ apiEndpoint: '/api/cap/' });
+    capRef.current = new Cap({ apiEndpoint: withBase('/api/cap/') });
     // 页面加载自动触发验证（隐藏模式）
     refreshCap();
+    axios.get('/api/setup/status')
+      .then((res) => {
+        if (res.data?.setup_required) {
+          navigate('/setup');
+        }
+      })
+      .catch(() => {});
+    axios.get('/api/oidc/config')
+      .then((res) => setSsoEnabled(Boolean(res.data?.enabled)))
+      .catch(() => setSsoEnabled(false));
+    if (passkeySupported()) {
+      axios.get('/api/passkey/config')
+        .then((res) => setPasskeyEnabled(Boolean(res.data?.enabled)))
+        .catch(() => setPasskeyEnabled(false));
+    }
     return () => {
       try {
         if (capRef.current?.reset) capRef.current.reset();
@@ -48,6 +69,9 @@ export default function LoginPage() {
       const form = new URLSearchParams();
       form.append('password', password);
       form.append('remember', remember ? '1' : '0');
+      if (otpRequired) {
+        form.append('otp', otp);
+      }
       let tokenToUse = capToken;
       if (!tokenToUse) {
         tokenToUse = await refreshCap();
@@ -67,12 +91,28 @@ export default function LoginPage() {
         navigate('/');
       }
     } catch (err) {
+      if (err.response?.data?.otp_required) {
+        setOtpRequired(true);
+        setErrMsg(otpRequired ? 'Invalid one-time password.' : 'Enter the code from your authenticator app or a recovery code.');
+        return;
+      }
       setErrMsg('Login failed,check you password.');
       console.error(err);
       // 密码错误后重新计算CAPTCHA
       await refreshCap();
     }
   };
+  const handlePasskeyLogin = async () => {
+    try {
+      const resp = await loginWithPasskey(remember);
+      if (resp) {
+        navigate('/');
+      }
+    } catch (err) {
+      setErrMsg('Passkey login failed.');
+      console.error(err);
+    }
+  };
   const handleKeyDown = (e) => {
     if (e.key === 'Enter') {
       handleLogin();
@@ -107,6 +147,20 @@ export default function LoginPage() {
           autoFocus
         />
 
+        {otpRequired && (
+          <TextField
+            label="One-time password"
+            variant="outlined"
+            fullWidth
+            margin="normal"
+            value={otp}
+            onChange={(e) => setOtp(e.target.value)}
+            onKeyDown={handleKeyDown}
+            autoComplete="one-time-code"
+            autoFocus
+          />
+        )}
+
         <Box width="100%" sx={{ mt: 1 }}>
           <FormControlLabel
             control={
@@ -136,6 +190,30 @@ export default function LoginPage() {
         >
           LOGIN
         </Button>
+
+        {ssoEnabled && (
+          <Button
+            variant="outlined"
+            color="primary"
+            fullWidth
+            href={`${withBase('/api/oidc/login')}?remember=${remember ? '1' : '0'}`}
+            sx={{ mt: 1 }}
+          >
+            SIGN IN WITH SSO
+          </Button>
+        )}
+
+        {passkeyEnabled && (
+          <Button
+            variant="outlined"
+            color="primary"
+            fullWidth
+            onClick={handlePasskeyLogin}
+            sx={{ mt: 1 }}
+          >
+            SIGN IN WITH PASSKEY
+          </Button>
+        )}
       </Box>
     </Container>
 
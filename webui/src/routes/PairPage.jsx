@@ -0,0 +1,82 @@
+import axios from 'axios';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+
+export default function PairPage() {
+  const [searchParams] = useSearchParams();
+  const [code, setCode] = useState('');
+  const [errMsg, setErrMsg] = useState('');
+  const navigate = useNavigate();
+  const token = searchParams.get('token');
+
+  const redeem = useCallback(async (params) => {
+    try {
+      const form = new URLSearchParams(params);
+      form.append('remember', '1');
+      await axios.post('/api/pair/redeem', form, {
+        headers: {
+          'Content-Type': 'application/x-www-form-urlencoded'
+        },
+        withCredentials: true
+      });
+      navigate('/');
+    } catch (err) {
+      console.error(err);
+      setErrMsg('Pairing failed, the code is invalid or expired.');
+    }
+  }, [navigate]);
+
+  useEffect(() => {
+    if (token) {
+      redeem({ token });
+    }
+  }, [token, redeem]);
+
+  return (
+    <Container maxWidth="xs" sx={{ mt: 18 }}>
+      <Box
+        display="flex"
+        flexDirection="column"
+        alignItems="center"
+        justifyContent="center"
+        padding={4}
+        boxShadow={3}
+        bgcolor="background.paper"
+        borderRadius={2}
+      >
+        <Typography variant="h5" gutterBottom>
+          Pair Device
+        </Typography>
+
+        <TextField
+          label="Pairing code"
+          variant="outlined"
+          fullWidth
+          margin="normal"
+          value={code}
+          onChange={(e) => setCode(e.target.value)}
+          onKeyDown={(e) => e.key === 'Enter' && redeem({ code })}
+          inputProps={{ inputMode: 'numeric', maxLength: 6 }}
+          autoFocus
+        />
+
+        {errMsg && (
+          <Box width="100%">
+            <Alert severity="error">
+              {errMsg}
+            </Alert>
+          </Box>
+        )}
+
+        <Button
+          variant="contained"
+          color="primary"
+          fullWidth
+          onClick={() => redeem({ code })}
+          sx={{ mt: 2 }}
+        >
+          PAIR
+        </Button>
+      </Box>
+    </Container>
+  );
+}
@@ -6,8 +6,8 @@ export default function PrivateRoute({ children }) {
     const navigate = useNavigate();
 
     useEffect(() => {
-        const token = Cookies.get('droptoken');
-        setIsAuthenticated(!!token);
+        // droptoken is HttpOnly; droplogin only tells that a session exists.
+        setIsAuthenticated(!!Cookies.get('droplogin'));
     }, []);
 
     useEffect(() => {
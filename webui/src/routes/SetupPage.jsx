@@ -0,0 +1,114 @@
+import axios from 'axios';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+
+export default function SetupPage() {
+  const [searchParams] = useSearchParams();
+  const [token, setToken] = useState(searchParams.get('token') || '');
+  const [password, setPassword] = useState('');
+  const [confirm, setConfirm] = useState('');
+  const [errMsg, setErrMsg] = useState('');
+  const navigate = useNavigate();
+
+  useEffect(() => {
+    axios.get('/api/setup/status')
+      .then((res) => {
+        if (!res.data?.setup_required) {
+          navigate('/login');
+        }
+      })
+      .catch((err) => console.error(err));
+  }, [navigate]);
+
+  const handleSetup = async () => {
+    if (password !== confirm) {
+      setErrMsg('The passwords do not match.');
+      return;
+    }
+    try {
+      const form = new URLSearchParams();
+      form.append('token', token.trim());
+      form.append('password', password);
+      await axios.post('/api/setup', form, {
+        headers: {
+          'Content-Type': 'application/x-www-form-urlencoded'
+        },
+        withCredentials: true
+      });
+      navigate('/');
+    } catch (err) {
+      console.error(err);
+      setErrMsg(err.response?.data?.message || 'Setup failed.');
+    }
+  };
+
+  return (
+    <Container maxWidth="xs" sx={{ mt: 18 }}>
+      <Box
+        display="flex"
+        flexDirection="column"
+        alignItems="center"
+        justifyContent="center"
+        padding={4}
+        boxShadow={3}
+        bgcolor="background.paper"
+        borderRadius={2}
+      >
+        <Typography variant="h5" gutterBottom>
+          Set Up ArkDrop
+        </Typography>
+        <Typography variant="body2" color="text.secondary">
+          Enter the setup token printed in the server log and choose the admin password.
+        </Typography>
+
+        <TextField
+          label="Setup token"
+          variant="outlined"
+          fullWidth
+          margin="normal"
+          value={token}
+          onChange={(e) => setToken(e.target.value)}
+          autoFocus={!token}
+        />
+        <TextField
+          label="Password"
+          type="password"
+          variant="outlined"
+          fullWidth
+          margin="normal"
+          value={password}
+          onChange={(e) => setPassword(e.target.value)}
+          helperText="At least 12 characters, or 8 mixing three of lowercase, uppercase, digits and symbols."
+          autoFocus={!!token}
+        />
+        <TextField
+          label="Confirm password"
+          type="password"
+          variant="outlined"
+          fullWidth
+          margin="normal"
+          value={confirm}
+          onChange={(e) => setConfirm(e.target.value)}
+          onKeyDown={(e) => e.key === 'Enter' && handleSetup()}
+        />
+
+        {errMsg && (
+          <Box width="100%">
+            <Alert severity="error">
+              {errMsg}
+            </Alert>
+          </Box>
+        )}
+
+        <Button
+          variant="contained"
+          color="primary"
+          fullWidth
+          onClick={handleSetup}
+          sx={{ mt: 2 }}
+        >
+          SAVE
+        </Button>
+      </Box>
+    </Container>
+  );
+}
@@ -0,0 +1,6 @@
+// The server fills in <base href> with its base_path, e.g. /drop/.
+const baseElement = typeof document !== 'undefined' ? document.querySelector('base') : null;
+
+export const basePath = baseElement ? new URL(baseElement.href).pathname.replace(/\/$/, '') : '';
+
+export const withBase = (path) => `${basePath}${path}`;
@@ -0,0 +1,87 @@
+import axios from 'axios';
+
+const toBuffer = (value) => {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const padded = base64 + '='.repeat((4 - (base64.length % 4)) % 4);
+  return Uint8Array.from(atob(padded), (c) => c.charCodeAt(0)).buffer;
+};
+
+const toBase64Url = (buffer) => {
+  const bytes = new Uint8Array(buffer);
+  let binary = '';
+  bytes.forEach((b) => {
+    binary += String.fromCharCode(b);
+  });
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+};
+
+export const passkeySupported = () => typeof window !== 'undefined' && Boolean(window.PublicKeyCredential);
+
+export async function loginWithPasskey(remember) {
+  const begin = await axios.post('/api/passkey/login/begin');
+  const { session, options } = begin.data;
+  const publicKey = {
+    ...options.publicKey,
+    challenge: toBuffer(options.publicKey.challenge),
+    allowCredentials: (options.publicKey.allowCredentials || []).map((cred) => ({
+      ...cred,
+      id: toBuffer(cred.id),
+    })),
+  };
+
+  const assertion = await navigator.credentials.get({ publicKey });
+  const payload = {
+    id: assertion.id,
+    rawId: toBase64Url(assertion.rawId),
+    type: assertion.type,
+    response: {
+      clientDataJSON: toBase64Url(assertion.response.clientDataJSON),
+      authenticatorData: toBase64Url(assertion.response.authenticatorData),
+      signature: toBase64Url(assertion.response.signature),
+      userHandle: assertion.response.userHandle ? toBase64Url(assertion.response.userHandle) : null,
+    },
+  };
+
+  const query = new URLSearchParams({ session, remember: remember ? '1' : '0' });
+  const response = await axios.post(`/api/passkey/login/finish?${query.toString()}`, payload, {
+    withCredentials: true,
+  });
+  return response.data;
+}
+
+// code is the current one-time password, required while 2FA is enabled.
+export async function registerPasskey(name, code) {
+  const form = new URLSearchParams({ code: code || '' });
+  const begin = await axios.post('/api/passkey/register/begin', form, { withCredentials: true });
+  const { session, options } = begin.data;
+  const publicKey = {
+    ...options.publicKey,
+    challenge: toBuffer(options.publicKey.challenge),
+    user: {
+      ...options.publicKey.user,
+      id: toBuffer(options.publicKey.user.id),
+    },
+    excludeCredentials: (options.publicKey.excludeCredentials || []).map((cred) => ({
+      ...cred,
+      id: toBuffer(cred.id),
+    })),
+  };
+
+  const credential = await navigator.credentials.create({ publicKey });
+  const payload = {
+    id: credential.id,
+    rawId: toBase64Url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64Url(credential.response.clientDataJSON),
+      attestationObject: toBase64Url(credential.response.attestationObject),
+      transports: credential.response.getTransports ? credential.response.getTransports() : [],
+    },
+  };
+
+  const query = new URLSearchParams({ session, name });
+  const response = await axios.post(`/api/passkey/register/finish?${query.toString()}`, payload, {
+    withCredentials: true,
+  });
+  return response.data;
+}
@@ -5,6 +5,8 @@ import AutoImport from 'unplugin-auto-import/vite';
 
 // https://vite.dev/config/
 export default defineConfig({
+  // 资源使用相对地址，服务端通过 <base> 注入 base_path
+  base: './',
   plugins: [
     react(),
     AutoImport({
@@ -112,7 +114,8 @@ export default defineConfig({
         theme_color: '#3f51b5',
         background_color: '#3f51b5',
         lang: 'zh-CN',
-        start_url: '/',
+        start_url: '.',
+        scope: '.',
         dir: 'ltr',
         display: 'standalone',
         icons: [